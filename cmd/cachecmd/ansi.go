@@ -0,0 +1,76 @@
+package main
+
+import "io"
+
+// States of ansiStripper.
+const (
+	ansiText = iota
+	// After ESC.
+	ansiEscape
+	// In CSI sequence (ESC [) such as colors.
+	ansiCSI
+	// In OSC sequence (ESC ]) such as hyperlinks and window titles, which is
+	// terminated by BEL or ST (ESC \).
+	ansiOSC
+	ansiOSCEscape
+)
+
+// ansiStripper is a writer which removes ANSI escape sequences with -strip-ansi.
+// Sequences split into multiple writes are removed too.
+type ansiStripper struct {
+	w     io.Writer
+	state int
+	buf   []byte
+}
+
+func newANSIStripper(w io.Writer) *ansiStripper {
+	return &ansiStripper{w: w}
+}
+
+func (s *ansiStripper) Write(p []byte) (int, error) {
+	s.buf = s.buf[:0]
+	for _, b := range p {
+		switch s.state {
+		case ansiText:
+			if b == 0x1b {
+				s.state = ansiEscape
+			} else {
+				s.buf = append(s.buf, b)
+			}
+		case ansiEscape:
+			switch {
+			case b == '[':
+				s.state = ansiCSI
+			case b == ']':
+				s.state = ansiOSC
+			case b >= 0x20 && b <= 0x2f:
+				// Intermediate bytes of nF sequences such as ESC ( B.
+			default:
+				s.state = ansiText
+			}
+		case ansiCSI:
+			if b >= 0x40 && b <= 0x7e {
+				s.state = ansiText
+			}
+		case ansiOSC:
+			switch b {
+			case 0x07:
+				s.state = ansiText
+			case 0x1b:
+				s.state = ansiOSCEscape
+			}
+		case ansiOSCEscape:
+			if b == '\\' {
+				s.state = ansiText
+			} else {
+				s.state = ansiOSC
+			}
+		}
+	}
+	if len(s.buf) > 0 {
+		if _, err := s.w.Write(s.buf); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
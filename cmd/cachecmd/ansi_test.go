@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestANSIStripper(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "plain\n", want: "plain\n"},
+		{in: "\x1b[1;31mred\x1b[0m\n", want: "red\n"},
+		{in: "\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\", want: "link"},
+		{in: "\x1b]0;title\x07text", want: "text"},
+		{in: "\x1b(Bcharset\x1b=", want: "charset"},
+		{in: "\x1b[2K\rprogress", want: "\rprogress"},
+	}
+	for _, tt := range tests {
+		// Write byte by byte to test sequences split into writes.
+		buf := new(bytes.Buffer)
+		s := newANSIStripper(buf)
+		for i := 0; i < len(tt.in); i++ {
+			if n, err := s.Write([]byte{tt.in[i]}); n != 1 || err != nil {
+				t.Fatalf("Write() = %d, %v", n, err)
+			}
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("stripped %q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCacheCmd_Run_stripANSI(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	for i, strip := range []bool{false, true, true} {
+		stdout := new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  stdout,
+			stderr:  ioutil.Discard,
+			cmdName: "printf",
+			cmdArgs: []string{`\033[32mok\033[0m\n`},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir, stripANSI: strip},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		want := "\x1b[32mok\x1b[0m\n"
+		if strip {
+			want = "ok\n"
+		}
+		// The second and third runs replay the cache, which keeps colors.
+		if got := stdout.String(); got != want {
+			t.Errorf("#%d: got %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Why the command runs, recorded in -audit-log.
+const (
+	// No fresh cache is found, or -changed.
+	triggerMiss = "miss"
+	// Cache is used and the command runs in foreground to print fresh output
+	// with -tail.
+	triggerHit = "hit"
+	// Background update of expired cache with -async.
+	triggerAsync = "async"
+	// `cachecmd schedule`.
+	triggerSchedule = "schedule"
+	// The command is not cached (e.g. its output is over -max-output-size).
+	triggerUncached = "uncached"
+	// `cachecmd diff`.
+	triggerDiff = "diff"
+)
+
+// auditRecord is a line of -audit-log.
+type auditRecord struct {
+	Argv        []string  `json:"argv"`
+	Dir         string    `json:"dir,omitempty"`
+	Host        string    `json:"host,omitempty"`
+	PID         int       `json:"pid"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	ExitCode    int       `json:"exit_code"`
+	Error       string    `json:"error,omitempty"`
+	Key         string    `json:"key,omitempty"`
+	TriggeredBy string    `json:"triggered_by"`
+}
+
+// openAuditLog opens -audit-log to append. The command must not run if it
+// fails so that every execution is recorded.
+func (c *CacheCmd) openAuditLog() (*os.File, error) {
+	if c.opt.auditLog == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(c.opt.auditLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	return f, nil
+}
+
+// writeAudit appends the record of the command which ran from start with the
+// result runErr to the audit log f and closes it. A record is written with a
+// single write so that records of concurrent processes are not mixed.
+func (c *CacheCmd) writeAudit(f *os.File, start time.Time, runErr error) {
+	code, err := exitError(runErr)
+	r := auditRecord{
+		Argv:        append([]string{c.cmdName}, c.cmdArgs...),
+		PID:         os.Getpid(),
+		Start:       start,
+		End:         time.Now(),
+		ExitCode:    code,
+		TriggeredBy: c.opt.trigger,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if r.TriggeredBy == "" {
+		r.TriggeredBy = triggerMiss
+	}
+	if c.cacheAllowed() {
+		r.Key = c.cacheFileName()
+	}
+	r.Dir, _ = os.Getwd()
+	r.Host, _ = os.Hostname()
+	b, err := json.Marshal(r)
+	if err == nil {
+		_, err = f.Write(append(b, '\n'))
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		fmt.Fprintf(c.stderr, "cachecmd: failed to write audit log: %v\n", err)
+	}
+}
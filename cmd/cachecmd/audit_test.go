@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_Run_auditLog(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	auditLog := filepath.Join(tmpdir, "audit.jsonl")
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "sh",
+		cmdArgs: []string{"-c", "exit 3"},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir, auditLog: auditLog},
+	}
+	// The second run uses cache without running the command.
+	for i := 0; i < 2; i++ {
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := ioutil.ReadFile(auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSuffix(b, []byte("\n")), []byte("\n"))
+	if len(lines) != 1 {
+		t.Fatalf("got %d records, want 1: %s", len(lines), b)
+	}
+	var r auditRecord
+	if err := json.Unmarshal(lines[0], &r); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sh", "-c", "exit 3"}; !reflect.DeepEqual(r.Argv, want) {
+		t.Errorf("got argv %q, want %q", r.Argv, want)
+	}
+	if r.ExitCode != 3 || r.TriggeredBy != triggerMiss || r.Key != cachecmd.cacheFileName() {
+		t.Errorf("got %+v, want exit code 3, miss and key %s", r, cachecmd.cacheFileName())
+	}
+	if r.Start.IsZero() || r.End.Before(r.Start) {
+		t.Errorf("got start %v and end %v", r.Start, r.End)
+	}
+}
+
+func TestCacheCmd_Run_auditLog_openError(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	ran := filepath.Join(tmpdir, "ran")
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "touch",
+		cmdArgs: []string{ran},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir, auditLog: filepath.Join(tmpdir, "nodir", "audit.jsonl")},
+	}
+	if _, err := cachecmd.Run(context.TODO()); err == nil {
+		t.Error("got nil error for audit log which cannot be opened")
+	}
+	if fileexists(ran) {
+		t.Error("command ran without audit log")
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backend is a remote store of cache entry files shared with other machines.
+// The local cache directory is used as the first tier in front of it.
+type backend interface {
+	// get returns content and modification time of the entry file of the
+	// given slash-separated name. It returns error which satisfies
+	// os.IsNotExist if the entry does not exist.
+	get(name string) (io.ReadCloser, time.Time, error)
+	// put stores the entry file of the given name with modification time.
+	put(name string, r io.Reader, modTime time.Time) error
+}
+
+// newBackend returns backend of -backend URL. It returns nil if url is empty.
+// Entries in a directory are written with permission mode, or sharedFileMode
+// if it's 0 since the directory is shared with others.
+// Backends may keep local state in the cache directory dir.
+func newBackend(url, dir string, mode os.FileMode) (backend, error) {
+	url = withBackendPassword(url)
+	switch {
+	case url == "":
+		return nil, nil
+	case strings.HasPrefix(url, "file://"):
+		p := strings.TrimPrefix(url, "file://")
+		if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+			// file:///C:/path on Windows.
+			p = p[1:]
+		}
+		return dirBackend{dir: filepath.FromSlash(p), mode: mode}, nil
+	case filepath.IsAbs(url):
+		return dirBackend{dir: url, mode: mode}, nil
+	case strings.HasPrefix(url, "ssh://"):
+		b, err := newSSHBackend(url)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	case strings.HasPrefix(url, "git+"):
+		b, err := newGitBackend(url, dir)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	case strings.HasPrefix(url, "http://"), strings.HasPrefix(url, "https://"):
+		b, err := newWebDAVBackend(url)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unsupported -backend: %q", url)
+}
+
+// backendPasswordEnv is the environment variable of the password of -backend
+// URL which has user but no password. Background updates get the password by
+// it so that it's not written to refresh spec files.
+const backendPasswordEnv = "CACHECMD_BACKEND_PASSWORD"
+
+// splitBackendPassword returns -backend URL without password and the password.
+func splitBackendPassword(rawurl string) (string, string) {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.User == nil {
+		return rawurl, ""
+	}
+	password, ok := u.User.Password()
+	if !ok {
+		return rawurl, ""
+	}
+	u.User = url.User(u.User.Username())
+	return u.String(), password
+}
+
+// withBackendPassword sets the password of backendPasswordEnv to -backend URL
+// which has user but no password.
+func withBackendPassword(rawurl string) string {
+	password := os.Getenv(backendPasswordEnv)
+	if password == "" {
+		return rawurl
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil || u.User == nil {
+		return rawurl
+	}
+	if _, ok := u.User.Password(); ok {
+		return rawurl
+	}
+	u.User = url.UserPassword(u.User.Username(), password)
+	return u.String()
+}
+
+// dirBackend stores entries in a directory, which is typically on a network
+// file system.
+type dirBackend struct {
+	dir string
+	// mode is permission of entry files. 0 means sharedFileMode.
+	mode os.FileMode
+}
+
+func (d dirBackend) get(name string) (io.ReadCloser, time.Time, error) {
+	f, err := os.Open(filepath.Join(d.dir, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, err
+	}
+	return f, stat.ModTime(), nil
+}
+
+func (d dirBackend) put(name string, r io.Reader, modTime time.Time) error {
+	p := filepath.Join(d.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p), "tmp_cachecmd_")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	mode := d.mode
+	if mode == 0 {
+		mode = sharedFileMode
+	}
+	// Let others read the entry.
+	err = f.Chmod(mode)
+	if err == nil {
+		_, err = io.Copy(f, r)
+	}
+	if err == nil && isNetworkFS(filepath.Dir(p)) {
+		err = f.Sync()
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Chtimes(f.Name(), modTime, modTime)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	return err
+}
+
+// remoteName returns name of the entry of the given base path in backend.
+func (c *CacheCmd) remoteName(base string) string {
+	return path.Join(c.opt.namespace, filepath.Base(base)+".ENTRY")
+}
+
+// entryName returns the name of the entry of the command in the namespace,
+// which is signed with -hmac-key-file.
+func (c *CacheCmd) entryName() string {
+	return path.Join(c.opt.namespace, c.cacheFileName())
+}
+
+// pullEntry fetches the entry of the given base path from backend to the
+// local cache directory if it's newer than the local entry. The modification
+// time is kept to keep the age of cache.
+func (c *CacheCmd) pullEntry(remote backend, base string) error {
+	r, modTime, err := remote.get(c.remoteName(base))
+	if os.IsNotExist(err) || os.IsPermission(err) {
+		// Entries which are not readable (e.g. written by older cachecmd
+		// only for the user) are not found.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch cache from backend: %v", err)
+	}
+	defer r.Close()
+	if stat, err := os.Stat(base + ".ENTRY"); err == nil && !modTime.After(stat.ModTime()) {
+		return nil
+	}
+	f, err := createAtomicFile(base+".ENTRY", c.fileMode(), c.opt.fsync)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.abort()
+		return fmt.Errorf("failed to fetch cache from backend: %v", err)
+	}
+	// Do not replace the local entry with a broken one.
+	e, err := c.openEntry(f.Name())
+	if err != nil {
+		f.abort()
+		return fmt.Errorf("failed to fetch cache from backend: %v", err)
+	}
+	e.Close()
+	if err := os.Chtimes(f.Name(), modTime, modTime); err != nil {
+		f.abort()
+		return err
+	}
+	return f.commit()
+}
+
+// storeEntry stores the local entry of the given base path to backend in
+// background unless -backend-sync is set or it's already in background.
+func (c *CacheCmd) storeEntry(remote backend, base string) error {
+	if !c.opt.backendSync && !c.opt.refresh {
+		err := c.startPushEntry(base)
+		if err == nil {
+			return nil
+		}
+		fmt.Fprintf(c.stderr, "cachecmd: failed to store cache to backend in background: %v\n", err)
+	}
+	if err := putEntry(remote, c.remoteName(base), base+".ENTRY"); err != nil {
+		return fmt.Errorf("failed to store cache to backend: %v", err)
+	}
+	return nil
+}
+
+// putEntry stores the entry file of the given path to backend as name.
+func putEntry(remote backend, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return remote.put(name, f, stat.ModTime())
+}
+
+// pushSpec describes the entry which a background cachecmd process stores to
+// backend.
+type pushSpec struct {
+	Backend  string
+	CacheDir string
+	Mode     os.FileMode
+	Name     string
+	// Entry is path of the snapshot of the entry file, which is removed after
+	// it's stored.
+	Entry string
+}
+
+// pushSpec returns pushSpec of the entry snapshot of the given base path. The
+// password of -backend is not included, and it's passed by backendPasswordEnv
+// instead.
+func (c *CacheCmd) pushSpec(base, snapshot string) pushSpec {
+	backend, _ := splitBackendPassword(c.opt.backend)
+	return pushSpec{Backend: backend, CacheDir: c.opt.cacheDir, Mode: c.opt.mode, Name: c.remoteName(base),
+		Entry: snapshot}
+}
+
+// startPushEntry spawns a detached cachecmd process which stores the local
+// entry of the given base path to backend, so that slow uploads do not delay
+// the command. It stores a snapshot of the entry because the entry may be
+// replaced before it's stored.
+func (c *CacheCmd) startPushEntry(base string) error {
+	snapshot, err := ioutil.TempFile(c.opt.cacheDir, "tmp_cachecmd_push_")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	err = copyEntry(snapshot, base+".ENTRY")
+	if errClose := snapshot.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(snapshot.Name())
+		return err
+	}
+	spec := c.pushSpec(base, snapshot.Name())
+	f, err := ioutil.TempFile(c.opt.cacheDir, "tmp_cachecmd_push_")
+	if err != nil {
+		os.Remove(snapshot.Name())
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	err = json.NewEncoder(f).Encode(spec)
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(snapshot.Name())
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write push spec: %v", err)
+	}
+
+	logf, err := openBgLog(c.bgLogPath(), c.fileMode())
+	if err != nil {
+		os.Remove(snapshot.Name())
+		os.Remove(f.Name())
+		return err
+	}
+	defer logf.Close()
+	cmd := exec.Command(c.cachecmdExecutable(), "-internal-push", f.Name())
+	cmd.SysProcAttr = detachSysProcAttr()
+	if _, password := splitBackendPassword(c.opt.backend); password != "" {
+		cmd.Env = append(os.Environ(), backendPasswordEnv+"="+password)
+	}
+	cmd.Stderr = logf
+	if err := cmd.Start(); err != nil {
+		os.Remove(snapshot.Name())
+		os.Remove(f.Name())
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// copyEntry copies the entry file of the given path to f with its
+// modification time.
+func copyEntry(f *os.File, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		return fmt.Errorf("failed to copy entry: %v", err)
+	}
+	return os.Chtimes(f.Name(), stat.ModTime(), stat.ModTime())
+}
+
+// runInternalPush stores the entry described by the given push spec file to
+// backend. The spec file and the snapshot of the entry are removed. Errors
+// are written to stderr, which is background update log.
+func runInternalPush(path string) (int, error) {
+	logger := log.New(os.Stderr, "cachecmd: ", log.LstdFlags)
+	b, err := ioutil.ReadFile(path)
+	os.Remove(path)
+	if err != nil {
+		logger.Printf("failed to read push spec: %v", err)
+		return 1, nil
+	}
+	var spec pushSpec
+	if err := json.Unmarshal(b, &spec); err != nil {
+		logger.Printf("failed to parse push spec: %v", err)
+		return 1, nil
+	}
+	defer os.Remove(spec.Entry)
+	remote, err := newBackend(spec.Backend, spec.CacheDir, spec.Mode)
+	if err == nil {
+		err = putEntry(remote, spec.Name, spec.Entry)
+	}
+	if err != nil {
+		logger.Printf("failed to store %s to backend: %v", spec.Name, err)
+		return 1, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// changeNotifier runs -on-change hook with files of the previous and the new
+// cached stdout when the command updates cache with different stdout.
+type changeNotifier struct {
+	c         *CacheCmd
+	base      string
+	oldOutput string
+	newOutput *os.File
+	changed   bool
+}
+
+// newChangeNotifier returns nil if -on-change is not set. Methods of nil
+// changeNotifier do nothing.
+func (c *CacheCmd) newChangeNotifier(base string) (*changeNotifier, error) {
+	if c.opt.onChange == "" {
+		return nil, nil
+	}
+	f, err := ioutil.TempFile(c.opt.cacheDir, "tmp_cachecmd_change_")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %v", err)
+	}
+	return &changeNotifier{c: c, base: base, newOutput: f}, nil
+}
+
+// writer returns io.Writer to write the new cached stdout.
+func (n *changeNotifier) writer() io.Writer {
+	if n == nil {
+		return ioutil.Discard
+	}
+	return n.newOutput
+}
+
+// prepare saves the previous cached stdout if stdout is changed. It must be
+// called before the previous cache entry is replaced.
+func (n *changeNotifier) prepare(prev, meta entryMeta) error {
+	if n == nil || prev.StdoutHash == "" || sameOutput(prev, meta) {
+		return nil
+	}
+	f, err := ioutil.TempFile(n.c.opt.cacheDir, "tmp_cachecmd_change_")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	n.oldOutput = f.Name()
+	replay := *n.c
+	replay.stdout, replay.stderr = f, ioutil.Discard
+	replay.opt.replayTiming = false
+	_, err = replay.replayCache(n.base)
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save previous output: %v", err)
+	}
+	n.changed = true
+	return nil
+}
+
+// run runs the hook if stdout is changed and removes temp files. Errors of
+// the hook are reported to stderr and do not change the result of cachecmd.
+func (n *changeNotifier) run() {
+	if n == nil {
+		return
+	}
+	n.newOutput.Close()
+	defer os.Remove(n.newOutput.Name())
+	if n.oldOutput != "" {
+		defer os.Remove(n.oldOutput)
+	}
+	if !n.changed {
+		return
+	}
+	n.c.runEventHook(n.c.opt.onChange, hookEvent{
+		Event:     "change",
+		OldOutput: n.oldOutput,
+		NewOutput: n.newOutput.Name(),
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheCmd_Run_onChange(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	state := filepath.Join(tmpdir, "state")
+	out := filepath.Join(tmpdir, "out")
+	hook := `cat "$CACHECMD_OLD_OUTPUT" "$CACHECMD_NEW_OUTPUT" >> ` + out
+
+	for _, s := range []string{"a\n", "a\n", "b\n"} {
+		if err := ioutil.WriteFile(state, []byte(s), 0600); err != nil {
+			t.Fatal(err)
+		}
+		cachecmd := CacheCmd{
+			stdout:  ioutil.Discard,
+			stderr:  ioutil.Discard,
+			cmdName: "cat",
+			cmdArgs: []string{state},
+			opt:     option{ttl: 0, cacheDir: tmpdir, onChange: hook},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, _ := ioutil.ReadFile(out)
+	if got, want := string(b), "a\nb\n"; got != want {
+		t.Errorf("hook got %q, want %q", got, want)
+	}
+	files, _ := filepath.Glob(filepath.Join(tmpdir, "tmp_cachecmd_*"))
+	if len(files) != 0 {
+		t.Errorf("temp files are not removed: %v", files)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// checksumPrefix is the prefix of the trailer of cache file, which is followed
+// by SHA-256 checksum of the preceding content.
+const checksumPrefix = "\x00sha256:"
+
+// hmacPrefix is the prefix of the trailer of cache file signed with HMAC-SHA256
+// by -hmac-key-file instead of SHA-256 checksum. It has the same length as
+// checksumPrefix.
+const hmacPrefix = "\x00hmac256"
+
+const checksumTrailerLen = len(checksumPrefix) + sha256.Size
+
+// errBrokenCache is returned when cache file is truncated or corrupted.
+// Such cache is treated as cache miss.
+var errBrokenCache = errors.New("broken cache: checksum mismatch")
+
+// checksumWriter writes data to w and computes its checksum, or its HMAC if
+// key is not nil.
+type checksumWriter struct {
+	w      io.Writer
+	h      hash.Hash
+	prefix string
+}
+
+// newChecksumWriter returns checksumWriter of the entry of the given name (see
+// CacheCmd.entryName), which is signed with the content if key is not nil.
+func newChecksumWriter(w io.Writer, key []byte, name string) *checksumWriter {
+	h, prefix := newChecksumHash(key, name)
+	return &checksumWriter{w: w, h: h, prefix: prefix}
+}
+
+// newChecksumHash returns hash of the trailer and its prefix. HMAC covers the
+// name of the entry so that a signed entry cannot be used as the entry of
+// other commands by renaming it.
+func newChecksumHash(key []byte, name string) (hash.Hash, string) {
+	if key != nil {
+		h := hmac.New(sha256.New, key)
+		fmt.Fprintf(h, "%d:%s", len(name), name)
+		return h, hmacPrefix
+	}
+	return sha256.New(), checksumPrefix
+}
+
+func (cw *checksumWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.h.Write(p[:n])
+	return n, err
+}
+
+// writeTrailer writes the checksum of written data. It must be called after
+// all content is written.
+func (cw *checksumWriter) writeTrailer() error {
+	_, err := cw.w.Write(append([]byte(cw.prefix), cw.h.Sum(nil)...))
+	return err
+}
+
+// verifyChecksum verifies the trailer of cache file f and returns reader of
+// the content without the trailer. It returns errBrokenCache on mismatch. If
+// key is not nil, the trailer must be HMAC of the entry of the given name by
+// the key and unsigned files are also rejected.
+func verifyChecksum(f *os.File, key []byte, name string) (*io.SectionReader, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := stat.Size() - int64(checksumTrailerLen)
+	if size < 0 {
+		return nil, errBrokenCache
+	}
+	h, prefix := newChecksumHash(key, name)
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, size)); err != nil {
+		return nil, err
+	}
+	trailer := make([]byte, checksumTrailerLen)
+	if _, err := f.ReadAt(trailer, size); err != nil {
+		return nil, err
+	}
+	want := append([]byte(prefix), h.Sum(nil)...)
+	if !hmac.Equal(trailer, want) {
+		return nil, errBrokenCache
+	}
+	return io.NewSectionReader(f, 0, size), nil
+}
+
+// loadHMACKey loads the secret of -hmac-key-file to sign cache entries.
+// Trailing newlines of the file are ignored.
+func loadHMACKey(opt *option) error {
+	if opt.hmacKeyFile == "" || opt.hmacKey != nil {
+		return nil
+	}
+	b, err := ioutil.ReadFile(opt.hmacKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read -hmac-key-file: %v", err)
+	}
+	key := bytes.TrimRight(b, "\r\n")
+	if len(key) == 0 {
+		return fmt.Errorf("-hmac-key-file is empty: %s", opt.hmacKeyFile)
+	}
+	opt.hmacKey = key
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+
+	buf := new(bytes.Buffer)
+	cw := newChecksumWriter(buf, nil, "")
+	io.WriteString(cw, "content")
+	if err := cw.writeTrailer(); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "valid", data: valid},
+		{name: "truncated", data: valid[:len(valid)-1], wantErr: true},
+		{name: "corrupted", data: append([]byte("C"), valid[1:]...), wantErr: true},
+		{name: "empty", data: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(tmpdir, tt.name)
+		if err := ioutil.WriteFile(path, tt.data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := verifyChecksum(f, nil, "")
+		if tt.wantErr {
+			if err != errBrokenCache {
+				t.Errorf("%s: got %v, want errBrokenCache", tt.name, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: got error: %v", tt.name, err)
+		} else if b, _ := ioutil.ReadAll(r); string(b) != "content" {
+			t.Errorf("%s: got content %q, want %q", tt.name, b, "content")
+		}
+		f.Close()
+	}
+}
+
+func TestCacheCmd_Run_brokenCache(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	newCacheCmd := func(stdout io.Writer) *CacheCmd {
+		return &CacheCmd{
+			stdout:  stdout,
+			stderr:  ioutil.Discard,
+			cmdName: "date",
+			cmdArgs: []string{"+%N"},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir},
+		}
+	}
+	first := new(bytes.Buffer)
+	if _, err := newCacheCmd(first).Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(tmpdir, "*.ENTRY"))
+	if len(files) != 1 {
+		t.Fatalf("got %d cache files, want 1", len(files))
+	}
+	b, _ := ioutil.ReadFile(files[0])
+	if err := ioutil.WriteFile(files[0], b[:len(b)-1], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	second := new(bytes.Buffer)
+	if _, err := newCacheCmd(second).Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if second.String() == first.String() {
+		t.Errorf("broken cache is used: %q", second.String())
+	}
+	third := new(bytes.Buffer)
+	if _, err := newCacheCmd(third).Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if third.String() != second.String() {
+		t.Errorf("got %q, want recovered cache %q", third.String(), second.String())
+	}
+}
+
+func TestVerifyChecksum_hmac(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	write := func(key []byte) []byte {
+		buf := new(bytes.Buffer)
+		cw := newChecksumWriter(buf, key, "")
+		io.WriteString(cw, "content")
+		if err := cw.writeTrailer(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		key     []byte
+		wantErr bool
+	}{
+		{name: "signed", data: write([]byte("secret")), key: []byte("secret")},
+		{name: "other_key", data: write([]byte("other")), key: []byte("secret"), wantErr: true},
+		{name: "unsigned", data: write(nil), key: []byte("secret"), wantErr: true},
+		{name: "no_key", data: write([]byte("secret")), key: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(tmpdir, tt.name)
+		if err := ioutil.WriteFile(path, tt.data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = verifyChecksum(f, tt.key, "")
+		if tt.wantErr && err != errBrokenCache {
+			t.Errorf("%s: got %v, want errBrokenCache", tt.name, err)
+		} else if !tt.wantErr && err != nil {
+			t.Errorf("%s: got error: %v", tt.name, err)
+		}
+		f.Close()
+	}
+}
+
+func TestLoadHMACKey(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	path := filepath.Join(tmpdir, "key")
+	if err := ioutil.WriteFile(path, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	opt := option{hmacKeyFile: path}
+	if err := loadHMACKey(&opt); err != nil {
+		t.Fatal(err)
+	}
+	if string(opt.hmacKey) != "secret" {
+		t.Errorf("got key %q, want %q", opt.hmacKey, "secret")
+	}
+	ioutil.WriteFile(path, []byte("\n"), 0600)
+	if err := loadHMACKey(&option{hmacKeyFile: path}); err == nil {
+		t.Error("got nil error for empty key")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runClean(args []string) (int, error) {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:	cachecmd clean [flags]")
+		fmt.Fprintln(os.Stderr, "	cachecmd clean removes cache entries in the cache directory or namespace.")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Flags:")
+		fs.PrintDefaults()
+	}
+	cacheDirFlag := fs.String("cache_dir", cacheDir(), "cache directory.")
+	namespace := fs.String("namespace", "", "namespace to clean.")
+	volatile := fs.Bool("volatile", false, "clean cache of -volatile.")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+
+	dir, err := optionCacheDir(option{cacheDir: *cacheDirFlag, namespace: *namespace, volatile: *volatile})
+	if err != nil {
+		return 2, err
+	}
+	return 0, cleanDir(dir)
+}
+
+// namespaceDir returns cache directory for the given namespace.
+func namespaceDir(cacheDir, namespace string) (string, error) {
+	if namespace == "" {
+		return cacheDir, nil
+	}
+	if namespace == "." || namespace == ".." || strings.ContainsAny(namespace, `/\`) {
+		return "", fmt.Errorf("invalid namespace: %q", namespace)
+	}
+	return filepath.Join(cacheDir, namespace), nil
+}
+
+// cleanDir removes cache files in dir. It does not remove subdirectories,
+// which are other namespaces.
+func cleanDir(dir string) error {
+	fileinfos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, fi := range fileinfos {
+		if fi.IsDir() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNamespaceDir(t *testing.T) {
+	if got, err := namespaceDir("cache", ""); err != nil || got != "cache" {
+		t.Errorf("namespaceDir without namespace = %q, %v, want %q", got, err, "cache")
+	}
+	if got, err := namespaceDir("cache", "proj1"); err != nil || got != filepath.Join("cache", "proj1") {
+		t.Errorf("namespaceDir(proj1) = %q, %v, want %q", got, err, filepath.Join("cache", "proj1"))
+	}
+	for _, ns := range []string{".", "..", "a/b"} {
+		if _, err := namespaceDir("cache", ns); err == nil {
+			t.Errorf("namespaceDir(%q) got nil error", ns)
+		}
+	}
+}
+
+func TestCleanDir(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	ns := filepath.Join(tmpdir, "proj1")
+	if err := os.Mkdir(ns, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{filepath.Join(tmpdir, "v2-a.STDOUT"), filepath.Join(ns, "v2-b.STDOUT")} {
+		if err := ioutil.WriteFile(f, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cleanDir(ns); err != nil {
+		t.Fatal(err)
+	}
+	if fileexists(filepath.Join(ns, "v2-b.STDOUT")) {
+		t.Error("cache in namespace is not removed")
+	}
+	if !fileexists(filepath.Join(tmpdir, "v2-a.STDOUT")) {
+		t.Error("cache outside of namespace is removed")
+	}
+
+	if err := cleanDir(tmpdir); err != nil {
+		t.Fatal(err)
+	}
+	if fileexists(filepath.Join(tmpdir, "v2-a.STDOUT")) {
+		t.Error("cache is not removed")
+	}
+	if !fileexists(ns) {
+		t.Error("namespace directory is removed")
+	}
+}
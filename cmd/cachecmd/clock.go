@@ -0,0 +1,18 @@
+package main
+
+import "time"
+
+// clock provides the current time for freshness of cache so that it can be
+// replaced in tests.
+type clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// fixedClock is a clock which always returns the same time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_cacheAge_minuteBoundary(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	path := filepath.Join(tmpdir, "entry")
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The current time exactly on a minute boundary must be used as is.
+	now := time.Date(2018, 5, 1, 10, 0, 0, 0, time.Local)
+	if err := os.Chtimes(path, now.Add(-30*time.Second), now.Add(-30*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	c := CacheCmd{clock: fixedClock(now)}
+	if age, ok := c.cacheAge(path); !ok || age != 30*time.Second {
+		t.Errorf("cacheAge() = (%v, %v), want (30s, true)", age, ok)
+	}
+}
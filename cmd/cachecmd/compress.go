@@ -0,0 +1,56 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Compression codecs of cached output.
+const (
+	compressNone = ""
+	compressGzip = "gzip"
+)
+
+// validCompress returns error if the given codec is not supported.
+func validCompress(codec string) error {
+	switch codec {
+	case compressNone, compressGzip:
+		return nil
+	}
+	return fmt.Errorf("unsupported -compress: %q (supported: gzip)", codec)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// newCompressWriter returns io.WriteCloser which compresses data written to
+// w with the given codec. Close must be called to flush compressed data.
+func newCompressWriter(codec string, w io.Writer) (io.WriteCloser, error) {
+	switch codec {
+	case compressNone:
+		return nopWriteCloser{w}, nil
+	case compressGzip:
+		return gzip.NewWriter(w), nil
+	}
+	return nil, validCompress(codec)
+}
+
+// newDecompressReader returns io.Reader which reads cached output from r
+// compressed with the given codec.
+func newDecompressReader(codec string, r io.Reader) (io.Reader, error) {
+	switch codec {
+	case compressNone:
+		return r, nil
+	case compressGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("broken cache: %v", err)
+		}
+		return zr, nil
+	}
+	return nil, validCompress(codec)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCompress_roundTrip(t *testing.T) {
+	for _, codec := range []string{compressNone, compressGzip} {
+		buf := new(bytes.Buffer)
+		w, err := newCompressWriter(codec, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sw := newStreamWriter(w)
+		io.WriteString(sw.writer(streamStdout), "out\n")
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := newDecompressReader(codec, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout := new(bytes.Buffer)
+		if err := replayStream(r, stdout, ioutil.Discard); err != nil {
+			t.Fatalf("%q: %v", codec, err)
+		}
+		if got := stdout.String(); got != "out\n" {
+			t.Errorf("%q: got %q, want %q", codec, got, "out\n")
+		}
+	}
+}
+
+func TestValidCompress(t *testing.T) {
+	if err := validCompress("zstd"); err == nil {
+		t.Error("got nil error for unsupported codec")
+	}
+}
+
+func TestCacheCmd_Run_compress(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	for i := 0; i < 2; i++ {
+		stdout := new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  stdout,
+			stderr:  ioutil.Discard,
+			cmdName: "echo",
+			cmdArgs: []string{"hello"},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir, compress: compressGzip},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		if got := stdout.String(); got != "hello\n" {
+			t.Errorf("#%d: got %q, want %q", i, got, "hello\n")
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(tmpdir, "*.ENTRY"))
+	if len(files) != 1 {
+		t.Fatalf("got %d cache files, want 1", len(files))
+	}
+	b, _ := ioutil.ReadFile(files[0])
+	if !bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		t.Errorf("cache is not compressed: %q", b)
+	}
+}
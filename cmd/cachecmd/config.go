@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// config is cachecmd configuration stored as JSON in the config file.
+type config struct {
+	// Schedule is the list of commands which `cachecmd schedule` keeps fresh.
+	Schedule []scheduleConfig `json:"schedule"`
+	// Redact is the list of rules to redact secrets in output before caching.
+	Redact []redactRule `json:"redact"`
+	// Normalize is the list of rules to normalize output before it's compared
+	// with the previous output.
+	Normalize []normalizeRule `json:"normalize"`
+	// Policy is allow-list and deny-list of commands to cache.
+	Policy cachePolicy `json:"policy"`
+	// Wrap is the list of commands which `cachecmd shellenv` wraps with
+	// cachecmd.
+	Wrap []wrapConfig `json:"wrap"`
+}
+
+type wrapConfig struct {
+	// Command is the name of the command to wrap (e.g. "kubectl").
+	Command string `json:"command"`
+	// Flags is cachecmd flags (e.g. "-ttl=30s -key-env=KUBECONFIG").
+	Flags string `json:"flags"`
+}
+
+type scheduleConfig struct {
+	// Cron is cron-like schedule (e.g. "*/5 * * * *").
+	Cron string `json:"cron"`
+	// Command is cachecmd flags and a command (e.g. "-key-cwd hub issue").
+	Command string `json:"command"`
+}
+
+// loadConfig loads the config file. It returns empty config if the file does
+// not exist.
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// applyConfig applies settings of cfg to opt.
+func applyConfig(opt *option, cfg *config) {
+	opt.redact = cfg.Redact
+	opt.normalize = cfg.Normalize
+	opt.policy = cfg.Policy
+}
+
+// loadDefaultConfig loads the default config file and applies it to opt.
+func loadDefaultConfig(opt *option) error {
+	cfg, err := loadConfig(configPath())
+	if err != nil {
+		return err
+	}
+	applyConfig(opt, cfg)
+	return nil
+}
+
+func configPath() string {
+	return filepath.Join(xdgConfigHome(), "cachecmd", "config.json")
+}
+
+// REF: https://specifications.freedesktop.org/basedir-spec/basedir-spec-0.6.html
+func xdgConfigHome() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir != "" {
+		return dir
+	}
+	if runtime.GOOS == "windows" {
+		dir = os.Getenv("USERPROFILE")
+	} else {
+		dir = os.Getenv("HOME")
+	}
+	return filepath.Join(dir, ".config")
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	path := filepath.Join(tmpdir, "config.json")
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig() for missing file got error: %v", err)
+	}
+	if len(cfg.Schedule) != 0 {
+		t.Errorf("got %d schedules for missing file, want 0", len(cfg.Schedule))
+	}
+
+	content := `{"schedule": [{"cron": "*/5 * * * *", "command": "hub issue"}], "redact": [{"pattern": "ghp_\\w+"}], "wrap": [{"command": "hub", "flags": "-ttl=1m"}]}`
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Schedule) != 1 || cfg.Schedule[0].Cron != "*/5 * * * *" || cfg.Schedule[0].Command != "hub issue" {
+		t.Errorf("got unexpected schedule: %+v", cfg.Schedule)
+	}
+	if len(cfg.Redact) != 1 || cfg.Redact[0].Pattern != `ghp_\w+` {
+		t.Errorf("got unexpected redact rules: %+v", cfg.Redact)
+	}
+	if len(cfg.Wrap) != 1 || cfg.Wrap[0].Command != "hub" || cfg.Wrap[0].Flags != "-ttl=1m" {
+		t.Errorf("got unexpected wrap: %+v", cfg.Wrap)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil {
+		t.Error("got nil error for invalid config")
+	}
+}
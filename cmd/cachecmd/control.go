@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// childEnv returns environment variables for the command so that it can know
+// it's run by cachecmd.
+func (c *CacheCmd) childEnv() []string {
+	ttl := ttlValue(c.opt.ttl)
+	env := []string{
+		"CACHECMD=1",
+		"CACHECMD_KEY=" + c.opt.cacheKey,
+		"CACHECMD_TTL=" + ttl.String(),
+	}
+	if c.controlFile != "" {
+		env = append(env, "CACHECMD_CONTROL="+c.controlFile)
+	}
+	return env
+}
+
+// control is the request from the command written to CACHECMD_CONTROL file.
+// Each line of the file is `ttl=<duration>` to set TTL of the result or
+// `nocache` not to cache the result.
+type control struct {
+	ttl     time.Duration
+	noCache bool
+}
+
+// newControlFile creates an empty CACHECMD_CONTROL file.
+func (c *CacheCmd) newControlFile() (string, error) {
+	f, err := ioutil.TempFile(c.opt.cacheDir, "tmp_cachecmd_control_")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %v", err)
+	}
+	return f.Name(), f.Close()
+}
+
+func readControl(path string) (control, error) {
+	var ctl control
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ctl, nil
+	}
+	if err != nil {
+		return ctl, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "":
+		case line == "nocache":
+			ctl.noCache = true
+		case strings.HasPrefix(line, "ttl="):
+			var ttl ttlValue
+			if err := ttl.Set(strings.TrimPrefix(line, "ttl=")); err != nil {
+				return ctl, fmt.Errorf("invalid CACHECMD_CONTROL: %v", err)
+			}
+			ctl.ttl = time.Duration(ttl)
+			// Expire the result immediately.
+			ctl.noCache = ctl.noCache || ctl.ttl == 0
+		default:
+			return ctl, fmt.Errorf("invalid CACHECMD_CONTROL: %q", line)
+		}
+	}
+	return ctl, s.Err()
+}
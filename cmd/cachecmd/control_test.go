@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadControl(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	path := filepath.Join(tmpdir, "control")
+	tests := []struct {
+		in      string
+		want    control
+		wantErr bool
+	}{
+		{in: "", want: control{}},
+		{in: "ttl=1d\n", want: control{ttl: 24 * time.Hour}},
+		{in: "nocache\n", want: control{noCache: true}},
+		{in: "ttl=0\n", want: control{noCache: true}},
+		{in: "ttl=x\n", wantErr: true},
+		{in: "unknown\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := ioutil.WriteFile(path, []byte(tt.in), 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readControl(path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("readControl(%q) got error %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("readControl(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+	if _, err := readControl(filepath.Join(tmpdir, "removed")); err != nil {
+		t.Errorf("readControl of removed file got error: %v", err)
+	}
+}
+
+func TestCacheCmd_Run_control(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	tests := []struct {
+		script    string
+		wantCache bool
+		wantTTL   time.Duration
+	}{
+		{script: `echo "$CACHECMD $CACHECMD_KEY $CACHECMD_TTL"`, wantCache: true, wantTTL: time.Minute},
+		{script: `echo ttl=1h > "$CACHECMD_CONTROL"`, wantCache: true, wantTTL: time.Hour},
+		{script: `echo nocache > "$CACHECMD_CONTROL"`, wantCache: false},
+	}
+	for i, tt := range tests {
+		stdout := new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  stdout,
+			stderr:  ioutil.Discard,
+			cmdName: "sh",
+			cmdArgs: []string{"-c", tt.script},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir, cacheKey: "k"},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if got, want := stdout.String(), "1 k 1m0s\n"; got != want {
+				t.Errorf("env: got %q, want %q", got, want)
+			}
+		}
+		base := cachecmd.cacheFilePath()
+		if got := fileexists(base + ".ENTRY"); got != tt.wantCache {
+			t.Errorf("#%d: cached = %v, want %v", i, got, tt.wantCache)
+			continue
+		}
+		if tt.wantCache {
+			if got := cachecmd.ttl(base); got != tt.wantTTL {
+				t.Errorf("#%d: ttl = %v, want %v", i, got, tt.wantTTL)
+			}
+		}
+		files, _ := filepath.Glob(filepath.Join(tmpdir, "tmp_cachecmd_control_*"))
+		if len(files) > 0 {
+			t.Errorf("#%d: control file is not removed: %v", i, strings.Join(files, " "))
+		}
+	}
+}
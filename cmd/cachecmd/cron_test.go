@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron_matches(t *testing.T) {
+	tests := []struct {
+		cron string
+		t    string
+		want bool
+	}{
+		{cron: "* * * * *", t: "2018-05-01 10:03", want: true},
+		{cron: "*/5 * * * *", t: "2018-05-01 10:05", want: true},
+		{cron: "*/5 * * * *", t: "2018-05-01 10:03", want: false},
+		{cron: "0 6 * * *", t: "2018-05-01 06:00", want: true},
+		{cron: "0 6 * * *", t: "2018-05-01 07:00", want: false},
+		{cron: "0 9-17/2 * * 1-5", t: "2018-05-01 11:00", want: true},  // Tuesday
+		{cron: "0 9-17/2 * * 1-5", t: "2018-05-05 11:00", want: false}, // Saturday
+		{cron: "0 0 * * 7", t: "2018-05-06 00:00", want: true},         // Sunday
+		{cron: "0 0 1,15 * *", t: "2018-05-15 00:00", want: true},
+		{cron: "0 0 1 * 0", t: "2018-05-06 00:00", want: true}, // Sunday but not 1st
+	}
+	for _, tt := range tests {
+		sched, err := parseCron(tt.cron)
+		if err != nil {
+			t.Errorf("parseCron(%q) got error: %v", tt.cron, err)
+			continue
+		}
+		tm, _ := time.Parse("2006-01-02 15:04", tt.t)
+		if got := sched.matches(tm); got != tt.want {
+			t.Errorf("%q matches %s = %v, want %v", tt.cron, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestParseCron_invalid(t *testing.T) {
+	for _, cron := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := parseCron(cron); err == nil {
+			t.Errorf("parseCron(%q) got nil error", cron)
+		}
+	}
+}
+
+func TestCronSchedule_next(t *testing.T) {
+	tests := []struct {
+		cron string
+		t    string
+		want string
+	}{
+		{cron: "* * * * *", t: "2018-05-01 10:03:30", want: "2018-05-01 10:04"},
+		{cron: "0 6 * * *", t: "2018-05-01 05:59:00", want: "2018-05-01 06:00"},
+		{cron: "0 6 * * *", t: "2018-05-01 06:00:00", want: "2018-05-02 06:00"},
+		{cron: "0 6 * * 1-5", t: "2018-05-04 07:00:00", want: "2018-05-07 06:00"}, // Friday
+		{cron: "30 0 1 * *", t: "2018-12-15 00:00:00", want: "2019-01-01 00:30"},
+		{cron: "0 0 29 2 *", t: "2018-03-01 00:00:00", want: "2020-02-29 00:00"},
+		{cron: "0 0 30 2 *", t: "2018-03-01 00:00:00", want: ""},
+	}
+	for _, tt := range tests {
+		sched, err := parseCron(tt.cron)
+		if err != nil {
+			t.Errorf("parseCron(%q) got error: %v", tt.cron, err)
+			continue
+		}
+		tm, _ := time.Parse("2006-01-02 15:04:05", tt.t)
+		got := sched.next(tm)
+		if got.IsZero() {
+			if tt.want != "" {
+				t.Errorf("%q next of %s = zero, want %s", tt.cron, tt.t, tt.want)
+			}
+			continue
+		}
+		if s := got.Format("2006-01-02 15:04"); s != tt.want {
+			t.Errorf("%q next of %s = %s, want %s", tt.cron, tt.t, s, tt.want)
+		}
+	}
+}
+
+func TestParseExpireAt(t *testing.T) {
+	sched, err := parseExpireAt("06:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm, _ := time.Parse("2006-01-02 15:04", "2018-05-01 06:30")
+	if !sched.matches(tm) {
+		t.Errorf("06:30 does not match %v", tm)
+	}
+	for _, s := range []string{"6", "25:00", "x"} {
+		if _, err := parseExpireAt(s); err == nil {
+			t.Errorf("parseExpireAt(%q) got nil error", s)
+		}
+	}
+}
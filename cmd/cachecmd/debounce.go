@@ -0,0 +1,26 @@
+package main
+
+import "os"
+
+// refreshPending reports whether other invocation has started a background
+// update of the entry of the given base path within -debounce. Otherwise, it
+// records that this invocation starts one in the .REFRESH file.
+func (c *CacheCmd) refreshPending(base string) bool {
+	if c.opt.debounce <= 0 {
+		return false
+	}
+	path := base + ".REFRESH"
+	if age, ok := c.cacheAge(path); ok && age < c.opt.debounce {
+		return true
+	}
+	os.Remove(path)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, c.fileMode())
+	if err != nil {
+		// Other invocation has just created it.
+		return os.IsExist(err)
+	}
+	f.Close()
+	now := c.now()
+	os.Chtimes(path, now, now)
+	return false
+}
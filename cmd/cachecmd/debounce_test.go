@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_refreshPending(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	base := filepath.Join(tmpdir, "a")
+	now := time.Now()
+	c := &CacheCmd{opt: option{debounce: time.Second}, clock: fixedClock(now)}
+	if c.refreshPending(base) {
+		t.Error("refreshPending() = true for the first invocation, want false")
+	}
+	if !c.refreshPending(base) {
+		t.Error("refreshPending() = false within -debounce, want true")
+	}
+	c.clock = fixedClock(now.Add(2 * time.Second))
+	if c.refreshPending(base) {
+		t.Error("refreshPending() = true after -debounce, want false")
+	}
+}
+
+func TestCacheCmd_Run_debounce(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	const n = 5
+	outputs := make([]*bytes.Buffer, n)
+	var wg sync.WaitGroup
+	for i := range outputs {
+		outputs[i] = new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  outputs[i],
+			stderr:  ioutil.Discard,
+			cmdName: "sh",
+			cmdArgs: []string{"-c", "date +%N; sleep 0.2"},
+			opt:     option{ttl: 0, cacheDir: tmpdir, debounce: time.Minute, inflightTimeout: time.Minute},
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cachecmd.Run(context.TODO()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, out := range outputs[1:] {
+		if out.String() != outputs[0].String() {
+			t.Errorf("got outputs %q and %q, want the result of a single run", outputs[0], out)
+		}
+	}
+}
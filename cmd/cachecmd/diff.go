@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+func runDiff(args []string) (int, error) {
+	fs := newSubFlagSet("diff", "cachecmd diff [flags] {command}",
+		"cachecmd diff runs the command and prints unified diff of stdout against the cached result.\n"+
+			"Both are normalized by \"normalize\" rules of the config file. It does not update cache.\n"+
+			"It exits with 0 if stdout is unchanged and 1 if changed.")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2, nil
+	}
+	opt, err := resolveCacheKey(*flagOpt, fs.Arg(0))
+	if err != nil {
+		return 2, err
+	}
+	// Load "normalize" rules.
+	if err := loadDefaultConfig(&opt); err != nil {
+		return 2, err
+	}
+	if err := loadHMACKey(&opt); err != nil {
+		return 2, err
+	}
+	c := &CacheCmd{stdout: os.Stdout, stderr: os.Stderr, cmdName: fs.Arg(0), cmdArgs: fs.Args()[1:], opt: opt}
+	changed, err := c.diff(context.Background(), os.Stdout)
+	if err == errNoCache {
+		return exitCodeNoCache, err
+	}
+	if err != nil {
+		return 2, err
+	}
+	if changed {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// diff runs the command without updating cache and writes unified diff of its
+// stdout against the cached stdout to w. It reports whether stdout is changed.
+func (c *CacheCmd) diff(ctx context.Context, w io.Writer) (bool, error) {
+	base := c.cacheFilePath()
+	if !fileexists(base + ".ENTRY") {
+		return false, errNoCache
+	}
+	cached := new(bytes.Buffer)
+	replay := *c
+	replay.stdout, replay.stderr = cached, ioutil.Discard
+	replay.opt.replayTiming = false
+	if _, err := replay.replayCache(base); err != nil {
+		return false, err
+	}
+
+	fresh := new(bytes.Buffer)
+	run := *c
+	run.stdout = fresh
+	run.opt.trigger = triggerDiff
+	if _, err := exitError(run.runCmd(ctx, ioutil.Discard, ioutil.Discard)); err != nil {
+		return false, err
+	}
+	return writeOutputDiff(w, cached, fresh, c.opt.normalize)
+}
+
+// writeOutputDiff writes unified diff of cached and fresh output normalized by
+// the rules to w. It reports whether output is changed.
+func writeOutputDiff(w io.Writer, cached, fresh *bytes.Buffer, rules []normalizeRule) (bool, error) {
+	if len(rules) > 0 {
+		r, err := compileNormalizeRules(rules)
+		if err != nil {
+			return false, err
+		}
+		cached, fresh = normalizeBuffer(cached, r), normalizeBuffer(fresh, r)
+	}
+	if bytes.Equal(cached.Bytes(), fresh.Bytes()) {
+		return false, nil
+	}
+	ops := diffLines(splitLines(cached.String()), splitLines(fresh.String()))
+	writeUnifiedDiff(w, "cache", "fresh", ops)
+	return true, nil
+}
+
+// normalizeBuffer returns output in buf normalized by r.
+func normalizeBuffer(buf *bytes.Buffer, r redactor) *bytes.Buffer {
+	out := new(bytes.Buffer)
+	w := newRedactWriter(out, r)
+	w.Write(buf.Bytes())
+	w.Close()
+	return out
+}
+
+// splitLines splits s into lines with trailing newlines.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffOp is an operation of the edit script to convert one list of lines to
+// another. kind is ' ' (unchanged), '-' (deleted) or '+' (inserted).
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines returns the shortest edit script from a to b by Myers' algorithm.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(trace, a, b, offset)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrackDiff(trace [][]int, a, b []string, offset int) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{kind: ' ', line: a[x-1]})
+			x--
+			y--
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			ops = append(ops, diffOp{kind: '+', line: b[y-1]})
+			y--
+		} else {
+			ops = append(ops, diffOp{kind: '-', line: a[x-1]})
+			x--
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// diffContext is the number of unchanged lines around changes in unified
+// diff.
+const diffContext = 3
+
+// writeUnifiedDiff writes ops in unified diff format.
+func writeUnifiedDiff(w io.Writer, nameA, nameB string, ops []diffOp) {
+	// Include unchanged lines near changes in hunks.
+	include := make([]bool, len(ops))
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		for j := i - diffContext; j <= i+diffContext; j++ {
+			if j >= 0 && j < len(ops) {
+				include[j] = true
+			}
+		}
+	}
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", nameA, nameB)
+	lineA, lineB := 0, 0
+	for i := 0; i < len(ops); {
+		if !include[i] {
+			lineA++
+			lineB++
+			i++
+			continue
+		}
+		end := i
+		countA, countB := 0, 0
+		for ; end < len(ops) && include[end]; end++ {
+			if ops[end].kind != '+' {
+				countA++
+			}
+			if ops[end].kind != '-' {
+				countB++
+			}
+		}
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(lineA, countA), hunkRange(lineB, countB))
+		for ; i < end; i++ {
+			line := ops[i].line
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			fmt.Fprintf(w, "%c%s", ops[i].kind, line)
+		}
+		lineA += countA
+		lineB += countB
+	}
+}
+
+// hunkRange returns range of hunk header which starts after line start.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
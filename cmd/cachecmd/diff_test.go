@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{
+			a: "a\nb\nc\n",
+			b: "a\nB\nc\nd\n",
+			want: `--- cache
++++ fresh
+@@ -1,3 +1,4 @@
+ a
+-b
++B
+ c
++d
+`,
+		},
+		{
+			a: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			b: "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			want: `--- cache
++++ fresh
+@@ -1,3 +1,4 @@
++0
+ 1
+ 2
+ 3
+@@ -7,4 +8,3 @@
+ 7
+ 8
+ 9
+-10
+`,
+		},
+		{
+			a: "",
+			b: "a",
+			want: `--- cache
++++ fresh
+@@ -0,0 +1 @@
++a
+\ No newline at end of file
+`,
+		},
+	}
+	for _, tt := range tests {
+		buf := new(bytes.Buffer)
+		writeUnifiedDiff(buf, "cache", "fresh", diffLines(splitLines(tt.a), splitLines(tt.b)))
+		if got := buf.String(); got != tt.want {
+			t.Errorf("diff of %q and %q:\ngot:\n%s\nwant:\n%s", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCacheCmd_diff(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	state := tmpdir + "/state"
+	ioutil.WriteFile(state, []byte("a\nb\n"), 0600)
+	c := &CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "cat",
+		cmdArgs: []string{state},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir},
+	}
+	if _, err := c.diff(context.TODO(), ioutil.Discard); err != errNoCache {
+		t.Errorf("got %v without cache, want errNoCache", err)
+	}
+	if _, err := c.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := c.diff(context.TODO(), ioutil.Discard); err != nil || changed {
+		t.Errorf("diff() = %v, %v, want unchanged", changed, err)
+	}
+
+	ioutil.WriteFile(state, []byte("a\nc\n"), 0600)
+	buf := new(bytes.Buffer)
+	changed, err := c.diff(context.TODO(), buf)
+	if err != nil || !changed {
+		t.Errorf("diff() = %v, %v, want changed", changed, err)
+	}
+	if !strings.Contains(buf.String(), "-b\n+c\n") {
+		t.Errorf("unexpected diff:\n%s", buf.String())
+	}
+	// Cache is not updated.
+	if changed, _ := c.diff(context.TODO(), ioutil.Discard); !changed {
+		t.Error("cache is updated by diff")
+	}
+}
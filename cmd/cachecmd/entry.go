@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Cache entry is stored in a single .ENTRY file, which is renamed atomically
+// when it's updated. The layout is:
+//
+//	output stream of the command (see streamWriter), compressed with -compress
+//	metadata JSON
+//	4 bytes big endian length of metadata JSON
+//	checksum trailer (see checksumWriter)
+const entryMetaLenSize = 4
+
+// writeEntryMeta writes metadata and the checksum trailer after output
+// stream to finish cache entry.
+func writeEntryMeta(w *checksumWriter, meta entryMeta) error {
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	var size [entryMetaLenSize]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(b)))
+	if _, err := w.Write(append(b, size[:]...)); err != nil {
+		return err
+	}
+	return w.writeTrailer()
+}
+
+// cacheEntry is an opened cache entry file whose checksum is verified.
+type cacheEntry struct {
+	f    *os.File
+	meta entryMeta
+	// output is the output stream of the command.
+	output *io.SectionReader
+}
+
+// openEntry opens cache entry file of the command. It returns errBrokenCache
+// if the file is truncated or corrupted, if it's not signed by -hmac-key-file
+// as the entry of the command, or if it's the entry of other command.
+func (c *CacheCmd) openEntry(path string) (*cacheEntry, error) {
+	e, err := openEntryFile(path, c.opt.hmacKey, c.entryName())
+	if err != nil {
+		return nil, err
+	}
+	// Entries written before the command is stored in metadata do not have it.
+	if len(e.meta.Command) > 0 && !equalStrings(e.meta.Command, append([]string{c.cmdName}, c.cmdArgs...)) {
+		e.Close()
+		return nil, errBrokenCache
+	}
+	return e, nil
+}
+
+// openEntryFile opens cache entry file of the given name. It returns
+// errBrokenCache if the file is truncated or corrupted, or if it's not signed
+// by key (see verifyChecksum).
+func openEntryFile(path string, key []byte, name string) (*cacheEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := verifyChecksum(f, key, name)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	meta, size, err := readEntryMeta(content, content.Size())
+	if err != nil {
+		f.Close()
+		return nil, errBrokenCache
+	}
+	return &cacheEntry{f: f, meta: meta, output: io.NewSectionReader(content, 0, size)}, nil
+}
+
+func (e *cacheEntry) Close() error {
+	return e.f.Close()
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// readEntryMeta reads metadata at the end of content of the given size and
+// returns it with the size of output stream before the metadata.
+func readEntryMeta(r io.ReaderAt, size int64) (entryMeta, int64, error) {
+	var meta entryMeta
+	var b [entryMetaLenSize]byte
+	if size < entryMetaLenSize {
+		return meta, 0, fmt.Errorf("broken cache: too short")
+	}
+	if _, err := r.ReadAt(b[:], size-entryMetaLenSize); err != nil {
+		return meta, 0, err
+	}
+	metaSize := int64(binary.BigEndian.Uint32(b[:]))
+	outputSize := size - entryMetaLenSize - metaSize
+	if outputSize < 0 {
+		return meta, 0, fmt.Errorf("broken cache: invalid metadata size")
+	}
+	mb := make([]byte, metaSize)
+	if _, err := r.ReadAt(mb, outputSize); err != nil {
+		return meta, 0, err
+	}
+	if err := json.Unmarshal(mb, &meta); err != nil {
+		return meta, 0, fmt.Errorf("failed to parse metadata: %v", err)
+	}
+	return meta, outputSize, nil
+}
+
+// readMeta reads metadata of cache entry file without verifying checksum of
+// the whole file.
+func readMeta(path string) (entryMeta, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return entryMeta{}, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return entryMeta{}, err
+	}
+	size := stat.Size() - int64(checksumTrailerLen)
+	if size < 0 {
+		return entryMeta{}, errBrokenCache
+	}
+	meta, _, err := readEntryMeta(f, size)
+	return meta, err
+}
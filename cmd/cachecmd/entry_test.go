@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOpenEntry(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	path := filepath.Join(tmpdir, "v4-a.ENTRY")
+
+	buf := new(bytes.Buffer)
+	sum := newChecksumWriter(buf, nil, "")
+	io.WriteString(newStreamWriter(sum).writer(streamStdout), "out\n")
+	want := entryMeta{ExitCode: 3, StdoutHash: "abc", AdaptiveTTL: time.Minute, Command: []string{"echo", "out"}}
+	if err := writeEntryMeta(sum, want); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := openEntryFile(path, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	if !reflect.DeepEqual(e.meta, want) {
+		t.Errorf("got meta %+v, want %+v", e.meta, want)
+	}
+	stdout := new(bytes.Buffer)
+	if err := replayStream(e.output, stdout, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if got := stdout.String(); got != "out\n" {
+		t.Errorf("got output %q, want %q", got, "out\n")
+	}
+
+	if got, err := readMeta(path); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("readMeta() = %+v, %v, want %+v", got, err, want)
+	}
+}
+
+func TestWriteEntryMeta_exitCodeZero(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := writeEntryMeta(newChecksumWriter(buf, nil, ""), entryMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"exit_code":0`)) {
+		t.Errorf("exit code 0 is not written: %q", buf.Bytes())
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Eviction policies of -eviction, which decide which entries are removed first
+// while the total size exceeds -max-cache-size.
+const (
+	// Remove entries which are written first.
+	evictionFIFO = "fifo"
+	// Remove entries which are used least recently.
+	evictionLRU = "lru"
+	// Remove entries which are used least frequently.
+	evictionLFU = "lfu"
+	// Remove expired entries only.
+	evictionTTL = "ttl"
+)
+
+// evictionPolicies maps -eviction to the order of entries to remove. Nil means
+// no entries are removed by size.
+var evictionPolicies = map[string]func(a, b *gcEntry) bool{
+	evictionFIFO: func(a, b *gcEntry) bool {
+		return a.modTime.Before(b.modTime)
+	},
+	evictionLRU: func(a, b *gcEntry) bool {
+		return a.lastAccess().Before(b.lastAccess())
+	},
+	evictionLFU: func(a, b *gcEntry) bool {
+		if a.hits != b.hits {
+			return a.hits < b.hits
+		}
+		return a.lastAccess().Before(b.lastAccess())
+	},
+	evictionTTL: nil,
+}
+
+func validEviction(policy string) error {
+	if _, ok := evictionPolicies[policy]; !ok && policy != "" {
+		return fmt.Errorf("invalid -eviction: %q", policy)
+	}
+	return nil
+}
+
+// lastAccess returns when the entry is used last. It's when the entry is
+// written if it's not used.
+func (e *gcEntry) lastAccess() time.Time {
+	if e.accessed.After(e.modTime) {
+		return e.accessed
+	}
+	return e.modTime
+}
+
+// entryAccess is statistics of use of an entry stored in .ACCESS file.
+type entryAccess struct {
+	hits int
+	// misses is the number of times the command ran to store the entry.
+	misses int
+	// lastHit is zero if the entry is not used.
+	lastHit time.Time
+}
+
+// readAccess returns the statistics of the entry of the given base path.
+// Files written before misses are recorded have only hits and the last hit.
+func readAccess(base string) entryAccess {
+	var a entryAccess
+	b, err := ioutil.ReadFile(base + ".ACCESS")
+	if err != nil {
+		return a
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 2 {
+		return a
+	}
+	hits, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return a
+	}
+	nsec, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return a
+	}
+	a.hits = hits
+	if nsec > 0 {
+		a.lastHit = time.Unix(0, nsec)
+	}
+	if len(fields) > 2 {
+		a.misses, _ = strconv.Atoi(fields[2])
+	}
+	return a
+}
+
+// recordAccess records hit of the entry of the given base path for -eviction
+// of lru and lfu and `cachecmd ls`. Hits by concurrent processes may be lost,
+// which is fine for the order of eviction and the statistics.
+func (c *CacheCmd) recordAccess(base string) {
+	a := readAccess(base)
+	a.hits++
+	a.lastHit = c.now()
+	c.writeAccess(base, a)
+}
+
+// recordMiss records that the command ran to store the entry of the given
+// base path.
+func (c *CacheCmd) recordMiss(base string) {
+	a := readAccess(base)
+	a.misses++
+	c.writeAccess(base, a)
+}
+
+func (c *CacheCmd) writeAccess(base string, a entryAccess) {
+	var nsec int64
+	if !a.lastHit.IsZero() {
+		nsec = a.lastHit.UnixNano()
+	}
+	data := fmt.Sprintf("%d %d %d\n", a.hits, nsec, a.misses)
+	if err := ioutil.WriteFile(base+".ACCESS", []byte(data), c.fileMode()); err != nil && !os.IsPermission(err) {
+		fmt.Fprintf(c.stderr, "cachecmd: failed to record access: %v\n", err)
+	}
+}
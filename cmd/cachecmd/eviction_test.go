@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGCDir_eviction(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		eviction string
+		want     string
+	}{
+		// a is written first, b is used least recently and c is used least
+		// frequently.
+		{eviction: evictionFIFO, want: "b c"},
+		{eviction: evictionLRU, want: "a c"},
+		{eviction: evictionLFU, want: "a b"},
+		{eviction: evictionTTL, want: "a b c"},
+	}
+	for _, tt := range tests {
+		tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+		defer os.RemoveAll(tmpdir)
+		output := strings.Repeat("x", 1000)
+		access := map[string]string{
+			"a": fmt.Sprintf("5 %d", now.Add(-1*time.Minute).UnixNano()),
+			"b": fmt.Sprintf("3 %d", now.Add(-50*time.Minute).UnixNano()),
+			"c": fmt.Sprintf("1 %d", now.Add(-2*time.Minute).UnixNano()),
+		}
+		for i, name := range []string{"a", "b", "c"} {
+			base := filepath.Join(tmpdir, name)
+			writeTestEntry(t, base+".ENTRY", entryMeta{TTL: ttlNever}, output, now.Add(time.Duration(i-60)*time.Minute))
+			if err := ioutil.WriteFile(base+".ACCESS", []byte(access[name]), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := gcDir(tmpdir, 2500, tt.eviction, lockAuto, "", now); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, name := range []string{"a", "b", "c"} {
+			if fileexists(filepath.Join(tmpdir, name+".ENTRY")) {
+				got = append(got, name)
+			}
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("-eviction=%s: got entries %q, want %q", tt.eviction, got, tt.want)
+		}
+	}
+}
+
+func TestCacheCmd_recordAccess(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	for _, eviction := range []string{evictionFIFO, evictionLFU} {
+		tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+		defer os.RemoveAll(tmpdir)
+		cachecmd := CacheCmd{
+			stdout:  ioutil.Discard,
+			stderr:  ioutil.Discard,
+			cmdName: "echo",
+			cmdArgs: []string{"hello"},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir, eviction: eviction},
+			clock:   fixedClock(now),
+		}
+		for i := 0; i < 3; i++ {
+			if _, err := cachecmd.Run(context.TODO()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		a := readAccess(cachecmd.cacheFilePath())
+		if a.hits != 2 || a.misses != 1 {
+			t.Errorf("-eviction=%s: got %d hits and %d misses, want 2 and 1", eviction, a.hits, a.misses)
+		}
+		if !a.lastHit.Equal(now) {
+			t.Errorf("-eviction=%s: got last access %v, want %v", eviction, a.lastHit, now)
+		}
+	}
+}
+
+func TestCacheCmd_recordAccess_refresh(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "echo",
+		cmdArgs: []string{"hello"},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir},
+	}
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	// Throttled background update uses the cache instead of running the
+	// command.
+	refresh := cachecmd
+	refresh.opt.refresh = true
+	refresh.opt.minInterval = time.Hour
+	if _, err := refresh.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if a := readAccess(cachecmd.cacheFilePath()); a.hits != 0 || a.misses != 1 {
+		t.Errorf("got %d hits and %d misses, want 0 and 1", a.hits, a.misses)
+	}
+}
+
+func TestValidEviction(t *testing.T) {
+	for _, policy := range []string{"", evictionFIFO, evictionLRU, evictionLFU, evictionTTL} {
+		if err := validEviction(policy); err != nil {
+			t.Errorf("validEviction(%q) = %v", policy, err)
+		}
+	}
+	if err := validEviction("random"); err == nil {
+		t.Error("validEviction(random) = nil, want error")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// startFilter starts -filter shell command which reads stdout of the started
+// command cmd. waitCmd waits for cmd. It returns stdout of the filter and the
+// function to wait for both commands.
+func (c *CacheCmd) startFilter(cmd *exec.Cmd, waitCmd func() error, stdout *os.File) (*os.File, func() error, error) {
+	filter := shellCommand(c.opt.filter)
+	filter.Stdin = stdout
+	filter.Stderr = c.stderr
+	out, outW, err := os.Pipe()
+	if err == nil {
+		filter.Stdout = outW
+		err = filter.Start()
+		outW.Close()
+		if err != nil {
+			out.Close()
+		}
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		waitCmd()
+		return nil, nil, fmt.Errorf("failed to start filter: %v", err)
+	}
+	// Close the pipe in this process so that the command gets SIGPIPE if the
+	// filter exits before reading all output (e.g. head).
+	stdout.Close()
+	wait := func() error {
+		errCmd := waitCmd()
+		if err := filter.Wait(); err != nil {
+			return fmt.Errorf("filter failed: %v", err)
+		}
+		if isSIGPIPE(errCmd) {
+			return nil
+		}
+		return errCmd
+	}
+	return out, wait, nil
+}
+
+// isSIGPIPE reports whether err is an error of the command killed by SIGPIPE.
+func isSIGPIPE(err error) bool {
+	exiterr, ok := err.(*exec.ExitError)
+	if !ok {
+		return false
+	}
+	status, ok := exiterr.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGPIPE
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_Run_filter(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	tests := []struct {
+		name     string
+		cmdName  string
+		cmdArgs  []string
+		filter   string
+		want     string
+		wantCode int
+		wantErr  bool
+	}{
+		{name: "sort", cmdName: "sh", cmdArgs: []string{"-c", "echo b; echo a"}, filter: "sort", want: "a\nb\n"},
+		// The command gets SIGPIPE after head exits.
+		{name: "head", cmdName: "yes", filter: "head -n 2", want: "y\ny\n"},
+		{name: "command fails", cmdName: "sh", cmdArgs: []string{"-c", "echo a; exit 3"}, filter: "cat", want: "a\n", wantCode: 3},
+		{name: "filter fails", cmdName: "sh", cmdArgs: []string{"-c", "echo a"}, filter: "exit 1", wantErr: true},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 2; i++ {
+			stdout := new(bytes.Buffer)
+			cachecmd := CacheCmd{
+				stdout:  stdout,
+				stderr:  ioutil.Discard,
+				cmdName: tt.cmdName,
+				cmdArgs: tt.cmdArgs,
+				opt:     option{ttl: time.Minute, cacheDir: tmpdir, filter: tt.filter},
+			}
+			code, err := cachecmd.Run(context.TODO())
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%s: got nil error", tt.name)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if code != tt.wantCode || stdout.String() != tt.want {
+				t.Errorf("%s #%d: got (%d, %q), want (%d, %q)", tt.name, i, code, stdout.String(), tt.wantCode, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// freshWaitInterval is the interval of checking whether the entry is updated
+// with -fresh-wait.
+const freshWaitInterval = 10 * time.Millisecond
+
+// replayFresh starts background update of the entry of the given base path and
+// waits for it up to -fresh-wait. It replays the updated entry if the update
+// finishes in time and the current entry otherwise.
+func (c *CacheCmd) replayFresh(base string) (int, error) {
+	prev, err := os.Stat(base + ".ENTRY")
+	if err != nil {
+		return 0, err
+	}
+	if err := c.startUpdateCache(); err != nil {
+		return 0, err
+	}
+	deadline := time.Now().Add(c.opt.freshWait)
+	for time.Now().Before(deadline) {
+		time.Sleep(freshWaitInterval)
+		if fi, err := os.Stat(base + ".ENTRY"); err == nil && !os.SameFile(prev, fi) {
+			break
+		}
+	}
+	return c.replayHit(base)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_Run_freshWait(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh is not available")
+	}
+	bin, cleanup, err := prepareBinary(t)
+	defer cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	cachecmd := CacheCmd{
+		stderr:       ioutil.Discard,
+		cmdName:      "sh",
+		cmdArgs:      []string{"-c", "date +%N; sleep 0.3"},
+		opt:          option{ttl: time.Minute, cacheDir: tmpdir, async: true},
+		cachecmdExec: bin,
+	}
+	run := func(freshWait time.Duration) string {
+		stdout := new(bytes.Buffer)
+		cachecmd.stdout = stdout
+		cachecmd.opt.freshWait = freshWait
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		return stdout.String()
+	}
+	current := func() string {
+		var buf bytes.Buffer
+		c := cachecmd
+		c.stdout = &buf
+		c.replayCache(c.cacheFilePath())
+		return buf.String()
+	}
+
+	first := run(0)
+	if got := run(50 * time.Millisecond); got != first {
+		t.Errorf("got %q, want cached %q when the update does not finish in time", got, first)
+	}
+	// Wait for the update started above.
+	deadline := time.Now().Add(10 * time.Second)
+	for current() == first || isLocked(cachecmd.cacheFilePath()+".LOCK", cachecmd.opt.lockMode) {
+		if time.Now().After(deadline) {
+			t.Fatal("cache is not updated in background")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	cached := current()
+	if got := run(10 * time.Second); got == cached {
+		t.Errorf("got cached %q, want the updated result", got)
+	}
+}
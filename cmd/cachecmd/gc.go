@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tempFileMaxAge is age of temp files in cache directory after which they are
+// regarded as left by crashed cachecmd.
+const tempFileMaxAge = 24 * time.Hour
+
+// sidecarSuffixes are suffixes of files kept next to entries. They are removed
+// by gc after tempFileMaxAge if the entry does not exist.
+var sidecarSuffixes = []string{".UNCACHEABLE", ".FAILURES", ".LOCK", ".ACCESS", ".REFRESH"}
+
+// sidecarBase returns the base path of sidecar file name in dir.
+func sidecarBase(dir, name string) (string, bool) {
+	for _, suffix := range sidecarSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return filepath.Join(dir, strings.TrimSuffix(name, suffix)), true
+		}
+	}
+	return "", false
+}
+
+func runGC(args []string) (int, error) {
+	fs := newSubFlagSet("gc", "cachecmd gc [flags]",
+		"cachecmd gc removes expired cache entries in the cache directory or namespace, and old entries\n"+
+			"in the order of -eviction while the total size exceeds -max-cache-size.")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	dir, err := optionCacheDir(*flagOpt)
+	if err != nil {
+		return 2, err
+	}
+	if _, err := gcDir(dir, flagOpt.maxCacheSize, flagOpt.eviction, flagOpt.lockMode, "", time.Now()); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// gcEntry is a cache entry and its related files in cache directory.
+type gcEntry struct {
+	base    string
+	files   []string
+	size    int64
+	modTime time.Time
+	// hits and accessed are the number and the last time of hits recorded for
+	// -eviction.
+	hits     int
+	accessed time.Time
+}
+
+// gcDir removes expired entries, broken entries, old temp files, stale
+// in-progress markers and old sidecar files of removed entries in dir. Then it removes entries in the order of the
+// eviction policy until the total size is at most maxSize if maxSize is
+// positive. Entries being updated and the entry of the base path keep are not
+// removed. It returns the number of removed entries.
+func gcDir(dir string, maxSize int64, eviction, lockMode, keep string, now time.Time) (int, error) {
+	fileinfos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	entries := make(map[string]*gcEntry)
+	var history, sidecars []os.FileInfo
+	for _, fi := range fileinfos {
+		name := fi.Name()
+		switch {
+		case fi.IsDir():
+		case strings.HasPrefix(name, refreshSpecPrefix):
+			// Interrupted update which `cachecmd schedule` resumes.
+		case strings.HasPrefix(name, "tmp_cachecmd_") || strings.HasPrefix(name, ".") && strings.Contains(name, ".tmp"):
+			if now.Sub(fi.ModTime()) > tempFileMaxAge {
+				os.Remove(filepath.Join(dir, name))
+			}
+		case strings.HasSuffix(name, ".PARTIAL"):
+			// In-progress marker left by crashed cachecmd.
+			base := filepath.Join(dir, strings.TrimSuffix(name, ".PARTIAL"))
+			if !isLocked(base+".LOCK", lockMode) {
+				os.Remove(base + ".PARTIAL")
+			}
+		case strings.HasSuffix(name, ".ENTRY"):
+			base := filepath.Join(dir, strings.TrimSuffix(name, ".ENTRY"))
+			entries[base] = &gcEntry{base: base, files: []string{base + ".ENTRY"},
+				size: fi.Size(), modTime: fi.ModTime()}
+		case strings.Contains(name, ".HISTORY."):
+			history = append(history, fi)
+		default:
+			if _, ok := sidecarBase(dir, name); ok {
+				sidecars = append(sidecars, fi)
+			}
+		}
+	}
+	for _, fi := range sidecars {
+		base, _ := sidecarBase(dir, fi.Name())
+		if _, ok := entries[base]; ok || now.Sub(fi.ModTime()) <= tempFileMaxAge {
+			continue
+		}
+		if strings.HasSuffix(fi.Name(), ".LOCK") && isLocked(base+".LOCK", lockMode) {
+			// The entry is being created.
+			continue
+		}
+		os.Remove(filepath.Join(dir, fi.Name()))
+	}
+	for _, fi := range history {
+		base := filepath.Join(dir, fi.Name()[:strings.Index(fi.Name(), ".HISTORY.")])
+		if e, ok := entries[base]; ok {
+			e.files = append(e.files, filepath.Join(dir, fi.Name()))
+			e.size += fi.Size()
+		}
+	}
+	for _, e := range entries {
+		a := readAccess(e.base)
+		e.hits, e.accessed = a.hits, a.lastHit
+	}
+
+	removed := 0
+	var live []*gcEntry
+	var total int64
+	for _, e := range entries {
+		if e.base == keep || isLocked(e.base+".LOCK", lockMode) {
+			total += e.size
+			continue
+		}
+		if entryExpired(e.base+".ENTRY", now.Sub(e.modTime)) {
+			if err := e.remove(); err != nil {
+				return removed, err
+			}
+			removed++
+			continue
+		}
+		live = append(live, e)
+		total += e.size
+	}
+	less := evictionPolicies[eviction]
+	if eviction == "" {
+		less = evictionPolicies[evictionFIFO]
+	}
+	if maxSize <= 0 || total <= maxSize || less == nil {
+		return removed, nil
+	}
+	sort.Slice(live, func(i, j int) bool { return less(live[i], live[j]) })
+	for _, e := range live {
+		if total <= maxSize {
+			break
+		}
+		if err := e.remove(); err != nil {
+			return removed, err
+		}
+		removed++
+		total -= e.size
+	}
+	return removed, nil
+}
+
+// entryExpired reports whether the entry of the given age is broken or older
+// than TTL stored in it. Entries without stored TTL are not expired.
+func entryExpired(path string, age time.Duration) bool {
+	meta, err := readMeta(path)
+	if err != nil {
+		return true
+	}
+	ttl := meta.TTL
+	if meta.AdaptiveTTL > ttl {
+		ttl = meta.AdaptiveTTL
+	}
+	return ttl > 0 && ttl < ttlNever && age >= ttl
+}
+
+// remove removes the entry and its related files.
+func (e *gcEntry) remove() error {
+	for _, f := range append(e.files, e.base+".UNCACHEABLE", e.base+".FAILURES", e.base+".ACCESS", e.base+".REFRESH") {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove cache: %v", err)
+		}
+	}
+	return nil
+}
+
+// maybeGC runs gc in the cache directory with probability of -gc after the
+// entry of the given base path is stored.
+func (c *CacheCmd) maybeGC(base string) {
+	if c.opt.gcProbability <= 0 || rand.New(rand.NewSource(time.Now().UnixNano())).Float64() >= c.opt.gcProbability {
+		return
+	}
+	if _, err := gcDir(c.opt.cacheDir, c.opt.maxCacheSize, c.opt.eviction, c.opt.lockMode, base, c.now()); err != nil {
+		fmt.Fprintf(c.stderr, "cachecmd: failed to gc: %v\n", err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestEntry writes cache entry of the given meta and output to path with
+// modification time mtime.
+func writeTestEntry(t *testing.T, path string, meta entryMeta, output string, mtime time.Time) {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	sum := newChecksumWriter(buf, nil, "")
+	io.WriteString(newStreamWriter(sum).writer(streamStdout), output)
+	if err := writeEntryMeta(sum, meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGCDir_expired(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	now := time.Now()
+	p := func(name string) string { return filepath.Join(tmpdir, name) }
+
+	writeTestEntry(t, p("expired.ENTRY"), entryMeta{TTL: time.Minute}, "a", now.Add(-2*time.Minute))
+	writeTestEntry(t, p("expired.HISTORY.1"), entryMeta{TTL: time.Minute}, "a", now.Add(-time.Hour))
+	ioutil.WriteFile(p("expired.FAILURES"), []byte("1"), 0600)
+	writeTestEntry(t, p("fresh.ENTRY"), entryMeta{TTL: time.Minute}, "a", now)
+	writeTestEntry(t, p("adaptive.ENTRY"), entryMeta{TTL: time.Minute, AdaptiveTTL: time.Hour}, "a", now.Add(-2*time.Minute))
+	writeTestEntry(t, p("never.ENTRY"), entryMeta{TTL: ttlNever}, "a", now.Add(-24*time.Hour))
+	ioutil.WriteFile(p("broken.ENTRY"), []byte("broken"), 0600)
+	ioutil.WriteFile(p("tmp_cachecmd_old"), nil, 0600)
+	os.Chtimes(p("tmp_cachecmd_old"), now.Add(-48*time.Hour), now.Add(-48*time.Hour))
+	ioutil.WriteFile(p("tmp_cachecmd_new"), nil, 0600)
+
+	n, err := gcDir(tmpdir, 0, evictionFIFO, lockAuto, "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("gcDir() removed %d entries, want 2", n)
+	}
+	var got []string
+	fileinfos, _ := ioutil.ReadDir(tmpdir)
+	for _, fi := range fileinfos {
+		got = append(got, fi.Name())
+	}
+	want := "adaptive.ENTRY fresh.ENTRY never.ENTRY tmp_cachecmd_new"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got files %q, want %q", got, want)
+	}
+}
+
+func TestGCDir_refreshSpec(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	now := time.Now()
+	spec := filepath.Join(tmpdir, refreshSpecPrefix+"old")
+	ioutil.WriteFile(spec, []byte("{}"), 0600)
+	os.Chtimes(spec, now.Add(-48*time.Hour), now.Add(-48*time.Hour))
+	if _, err := gcDir(tmpdir, 0, evictionFIFO, lockAuto, "", now); err != nil {
+		t.Fatal(err)
+	}
+	if !fileexists(spec) {
+		t.Error("old refresh spec is removed before it's resumed")
+	}
+}
+
+func TestGCDir_maxSize(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	now := time.Now()
+	output := strings.Repeat("x", 1000)
+	for i, name := range []string{"a", "b", "c", "d"} {
+		writeTestEntry(t, filepath.Join(tmpdir, name+".ENTRY"), entryMeta{TTL: ttlNever}, output, now.Add(time.Duration(i)*time.Minute))
+	}
+	// a is the oldest but kept.
+	n, err := gcDir(tmpdir, 2500, evictionFIFO, lockAuto, filepath.Join(tmpdir, "a"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("gcDir() removed %d entries, want 2", n)
+	}
+	for _, name := range []string{"a", "d"} {
+		if !fileexists(filepath.Join(tmpdir, name+".ENTRY")) {
+			t.Errorf("%s is removed", name)
+		}
+	}
+}
+
+func TestCacheCmd_Run_gc(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	expired := filepath.Join(tmpdir, "expired.ENTRY")
+	writeTestEntry(t, expired, entryMeta{TTL: time.Minute}, "a", time.Now().Add(-time.Hour))
+
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "echo",
+		cmdArgs: []string{"hello"},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir, gcProbability: 1},
+	}
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if fileexists(expired) {
+		t.Error("expired entry is not removed with -gc=100%")
+	}
+	if !fileexists(cachecmd.cacheFilePath() + ".ENTRY") {
+		t.Error("new entry is removed")
+	}
+}
+
+func TestGCDir_orphanedSidecars(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	now := time.Now()
+	p := func(name string) string { return filepath.Join(tmpdir, name) }
+
+	writeTestEntry(t, p("live.ENTRY"), entryMeta{TTL: ttlNever}, "a", now.Add(-48*time.Hour))
+	for _, suffix := range sidecarSuffixes {
+		for _, base := range []string{"live", "removed", "new"} {
+			ioutil.WriteFile(p(base+suffix), nil, 0600)
+			if base != "new" {
+				os.Chtimes(p(base+suffix), now.Add(-48*time.Hour), now.Add(-48*time.Hour))
+			}
+		}
+	}
+	if _, err := gcDir(tmpdir, 0, evictionFIFO, lockAuto, "", now); err != nil {
+		t.Fatal(err)
+	}
+	for _, suffix := range sidecarSuffixes {
+		if fileexists(p("removed" + suffix)) {
+			t.Errorf("orphaned %s is not removed", suffix)
+		}
+		if !fileexists(p("live"+suffix)) || !fileexists(p("new"+suffix)) {
+			t.Errorf("%s of live entry or new %s is removed", suffix, suffix)
+		}
+	}
+}
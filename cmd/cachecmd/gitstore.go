@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitPushRetry is the number of retries to push when other machine pushed the
+// branch first.
+const gitPushRetry = 3
+
+// gitBackend stores entries in a branch of a git repository, which gives
+// versioned history of cached results and replication by push and fetch. It
+// keeps a local repository in the cache directory.
+type gitBackend struct {
+	remote string
+	branch string
+	work   string
+}
+
+// newGitBackend returns gitBackend of URL like git+ssh://host/repo.git#branch
+// in the given cache directory. The default branch is cachecmd.
+func newGitBackend(rawurl, dir string) (*gitBackend, error) {
+	remote, branch := strings.TrimPrefix(rawurl, "git+"), "cachecmd"
+	if i := strings.LastIndex(remote, "#"); i >= 0 {
+		remote, branch = remote[:i], remote[i+1:]
+	}
+	if remote == "" || branch == "" {
+		return nil, fmt.Errorf("invalid -backend: %q", rawurl)
+	}
+	sum := sha256.Sum256([]byte(remote))
+	return &gitBackend{
+		remote: remote,
+		branch: branch,
+		work:   filepath.Join(dir, fmt.Sprintf(".git-backend-%x", sum[:8])),
+	}, nil
+}
+
+func (b *gitBackend) git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", b.work}, args...)...)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("git %s failed: %v: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// lock initializes the local repository and locks it. Processes of cachecmd
+// share the local repository.
+func (b *gitBackend) lock() (*lockFile, error) {
+	if err := os.MkdirAll(b.work, 0700); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(backendTimeout)
+	for {
+		l, err := tryLock(b.work+".LOCK", lockAuto, defaultFileMode)
+		if err != nil {
+			return nil, err
+		}
+		if l != nil {
+			if err := b.init(); err != nil {
+				l.unlock()
+				return nil, err
+			}
+			return l, nil
+		}
+		if !waitUnlock(b.work+".LOCK", lockAuto, time.Until(deadline)) {
+			return nil, fmt.Errorf("timed out to lock %s", b.work)
+		}
+	}
+}
+
+func (b *gitBackend) init() error {
+	if fileexists(filepath.Join(b.work, ".git")) {
+		return nil
+	}
+	if _, err := b.git("init", "-q"); err != nil {
+		return err
+	}
+	if _, err := b.git("remote", "add", "origin", b.remote); err != nil {
+		return err
+	}
+	// Commit as cachecmd unless the user configures git identity.
+	if _, err := b.git("config", "user.email"); err != nil {
+		b.git("config", "user.name", "cachecmd")
+		b.git("config", "user.email", "cachecmd@localhost")
+	}
+	return nil
+}
+
+// fetch fetches the branch and returns its remote-tracking ref. It returns
+// empty ref if the branch does not exist yet.
+func (b *gitBackend) fetch() (string, error) {
+	ref := "refs/remotes/origin/" + b.branch
+	_, err := b.git("fetch", "-q", "origin", "+refs/heads/"+b.branch+":"+ref)
+	if err == nil {
+		return ref, nil
+	}
+	cmd := exec.Command("git", "-C", b.work, "ls-remote", "--exit-code", "origin", "refs/heads/"+b.branch)
+	if exiterr, ok := cmd.Run().(*exec.ExitError); ok && exiterr.ExitCode() == 2 {
+		return "", nil
+	}
+	return "", err
+}
+
+func (b *gitBackend) get(name string) (io.ReadCloser, time.Time, error) {
+	l, err := b.lock()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer l.unlock()
+	ref, err := b.fetch()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	notExist := &os.PathError{Op: "get", Path: name, Err: os.ErrNotExist}
+	if ref == "" {
+		return nil, time.Time{}, notExist
+	}
+	if _, err := b.git("cat-file", "-e", ref+":"+name); err != nil {
+		return nil, time.Time{}, notExist
+	}
+	body, err := b.git("cat-file", "blob", ref+":"+name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	// Commit time is the time of push, so prefer the time in metadata.
+	var modTime time.Time
+	if meta, _, err := readEntryMeta(bytes.NewReader(body), int64(len(body)-checksumTrailerLen)); err == nil && meta.CachedAt != 0 {
+		modTime = time.Unix(0, meta.CachedAt)
+	} else if out, err := b.git("log", "-1", "--format=%ct", ref, "--", name); err == nil {
+		sec, _ := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+		modTime = time.Unix(sec, 0)
+	}
+	return ioutil.NopCloser(bytes.NewReader(body)), modTime, nil
+}
+
+// put commits the entry to the branch and pushes it. It retries when other
+// machine pushed the branch first. modTime is ignored because it's in entry
+// metadata.
+func (b *gitBackend) put(name string, r io.Reader, modTime time.Time) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	l, err := b.lock()
+	if err != nil {
+		return err
+	}
+	defer l.unlock()
+	for i := 0; ; i++ {
+		err := b.commit(name, body)
+		if err == nil {
+			_, err = b.git("push", "-q", "origin", "HEAD:refs/heads/"+b.branch)
+		}
+		if err == nil || i >= gitPushRetry {
+			return err
+		}
+	}
+}
+
+// commit commits the entry on top of the fetched branch.
+func (b *gitBackend) commit(name string, body []byte) error {
+	ref, err := b.fetch()
+	if err != nil {
+		return err
+	}
+	if ref != "" {
+		_, err = b.git("checkout", "-q", "-f", "-B", b.branch, ref)
+	} else {
+		_, err = b.git("symbolic-ref", "HEAD", "refs/heads/"+b.branch)
+	}
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(b.work, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(p, body, 0600); err != nil {
+		return err
+	}
+	if _, err := b.git("add", "--", name); err != nil {
+		return err
+	}
+	if _, err := b.git("diff", "--cached", "--quiet"); err == nil {
+		// The same entry is already committed.
+		return nil
+	}
+	_, err = b.git("commit", "-q", "-m", "cachecmd: update "+name)
+	return err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_Run_gitBackend(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	repo := filepath.Join(tmpdir, "cache.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", repo).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	backend := "git+file://" + filepath.ToSlash(repo)
+	run := func(local string, args ...string) string {
+		stdout := new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  stdout,
+			stderr:  ioutil.Discard,
+			cmdName: "date",
+			cmdArgs: args,
+			opt: option{ttl: time.Minute, cacheDir: filepath.Join(tmpdir, local),
+				namespace: "ns", backend: backend, backendSync: true},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		return stdout.String()
+	}
+	first := run("local1", "+%N")
+	// Other machine commits on top of the branch.
+	other := run("local2", "+%s%N")
+	if got := run("local2", "+%N"); got != first {
+		t.Errorf("got %q, want %q committed to git", got, first)
+	}
+	if got := run("local1", "+%s%N"); got != other {
+		t.Errorf("got %q, want %q committed by other machine", got, other)
+	}
+	out, err := exec.Command("git", "-C", repo, "log", "--format=%s", "cachecmd").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(out), "cachecmd: update ns/"); n != 2 {
+		t.Errorf("got %d commits, want 2: %s", n, out)
+	}
+}
+
+func TestNewGitBackend(t *testing.T) {
+	b, err := newGitBackend("git+ssh://host/repo.git#results", "/cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.remote != "ssh://host/repo.git" || b.branch != "results" || filepath.Dir(b.work) != filepath.FromSlash("/cache") {
+		t.Errorf("got %+v", b)
+	}
+	if _, err := newGitBackend("git+ssh://host/repo.git#", "/cache"); err == nil {
+		t.Error("got nil error for empty branch")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+func runHistory(args []string) (int, error) {
+	fs := newSubFlagSet("history", "cachecmd history [-show n] [flags] {command}",
+		"cachecmd history lists the current and previous cached results of the command kept with\n"+
+			"-history, newest first.")
+	show := fs.Int("show", -1, "print the n-th result in the list instead of listing results.")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2, nil
+	}
+	opt, err := resolveCacheKey(*flagOpt, fs.Arg(0))
+	if err != nil {
+		return 1, err
+	}
+	if err := loadHMACKey(&opt); err != nil {
+		return 2, err
+	}
+	c := &CacheCmd{stdout: os.Stdout, stderr: os.Stderr, cmdName: fs.Arg(0), cmdArgs: fs.Args()[1:], opt: opt}
+	paths, err := c.historyEntries(c.cacheFilePath())
+	if err != nil {
+		return 1, err
+	}
+	if *show < 0 {
+		return 0, listHistory(os.Stdout, paths)
+	}
+	if *show >= len(paths) {
+		return 1, fmt.Errorf("no result %d in history of %d results", *show, len(paths))
+	}
+	return c.replayEntry(paths[*show])
+}
+
+// historyPrefix returns the prefix of history entry files of the given base
+// path.
+func historyPrefix(base string) string {
+	return base + ".HISTORY."
+}
+
+// saveHistory keeps the current entry of the given base path as a history
+// entry before it's replaced and removes history entries more than -history.
+func (c *CacheCmd) saveHistory(base string) error {
+	if c.opt.history <= 0 {
+		return nil
+	}
+	path := base + ".ENTRY"
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Link instead of rename not to remove the current entry until it's
+	// replaced. File name has nanoseconds of the cached time to sort entries.
+	hist := fmt.Sprintf("%s%019d", historyPrefix(base), stat.ModTime().UnixNano())
+	if err := os.Link(path, hist); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to save history: %v", err)
+	}
+	paths, err := c.historyEntries(base)
+	if err != nil {
+		return err
+	}
+	// paths[0] is the current entry.
+	for i := c.opt.history + 1; i < len(paths); i++ {
+		os.Remove(paths[i])
+	}
+	return nil
+}
+
+// historyEntries returns paths of the current entry if exists and history
+// entries of the given base path, newest first.
+func (c *CacheCmd) historyEntries(base string) ([]string, error) {
+	fileinfos, err := ioutil.ReadDir(filepath.Dir(base))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(historyPrefix(base))
+	var hists []string
+	for _, fi := range fileinfos {
+		if strings.HasPrefix(fi.Name(), prefix) {
+			hists = append(hists, filepath.Join(filepath.Dir(base), fi.Name()))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(hists)))
+	var paths []string
+	if fileexists(base + ".ENTRY") {
+		paths = append(paths, base+".ENTRY")
+	}
+	return append(paths, hists...), nil
+}
+
+func listHistory(w io.Writer, paths []string) error {
+	for i, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		meta, err := readMeta(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		fmt.Fprintf(w, "%d\t%s\texit=%d\truntime=%v\n", i,
+			stat.ModTime().Format(time.RFC3339), meta.ExitCode, meta.Runtime)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_history(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	newCacheCmd := func() *CacheCmd {
+		return &CacheCmd{
+			stdout:  ioutil.Discard,
+			stderr:  ioutil.Discard,
+			cmdName: "date",
+			cmdArgs: []string{"+%N"},
+			opt:     option{ttl: 0, cacheDir: tmpdir, history: 2},
+		}
+	}
+	var outputs []string
+	for i := 0; i < 4; i++ {
+		stdout := new(bytes.Buffer)
+		c := newCacheCmd()
+		c.stdout = stdout
+		if _, err := c.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, stdout.String())
+		// Make modification time of entries different.
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c := newCacheCmd()
+	paths, err := c.historyEntries(c.cacheFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 3 {
+		t.Fatalf("got %d entries, want current and 2 history entries: %v", len(paths), paths)
+	}
+	for i, path := range paths {
+		stdout := new(bytes.Buffer)
+		c.stdout = stdout
+		if _, err := c.replayEntry(path); err != nil {
+			t.Fatal(err)
+		}
+		if want := outputs[len(outputs)-1-i]; stdout.String() != want {
+			t.Errorf("entry %d: got %q, want %q", i, stdout.String(), want)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := listHistory(buf, paths); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[2], "2\t") {
+		t.Errorf("unexpected history list:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hookEvent is passed to hooks. Shell command hooks receive it as CACHECMD_*
+// environment variables and webhooks receive it as JSON.
+type hookEvent struct {
+	Event    string   `json:"event"`
+	Command  []string `json:"command"`
+	Key      string   `json:"key"`
+	ExitCode int      `json:"exit_code"`
+	Error    string   `json:"error,omitempty"`
+	Failures int      `json:"failures,omitempty"`
+	// OldOutput and NewOutput are paths of files of the previous and the new
+	// cached stdout on change event.
+	OldOutput string `json:"old_output,omitempty"`
+	NewOutput string `json:"new_output,omitempty"`
+	// Path is path of the cache entry file.
+	Path string `json:"path,omitempty"`
+	// AgeSeconds is age of the cache entry on hit event.
+	AgeSeconds int `json:"age_seconds,omitempty"`
+	// RuntimeSeconds is wall-clock duration of the command on store and hit
+	// events.
+	RuntimeSeconds float64 `json:"runtime_seconds,omitempty"`
+}
+
+func (e hookEvent) env() []string {
+	return []string{
+		"CACHECMD_EVENT=" + e.Event,
+		"CACHECMD_COMMAND=" + strings.Join(e.Command, " "),
+		"CACHECMD_KEY=" + e.Key,
+		"CACHECMD_EXIT_CODE=" + strconv.Itoa(e.ExitCode),
+		"CACHECMD_ERROR=" + e.Error,
+		"CACHECMD_FAILURES=" + strconv.Itoa(e.Failures),
+		"CACHECMD_OLD_OUTPUT=" + e.OldOutput,
+		"CACHECMD_NEW_OUTPUT=" + e.NewOutput,
+		"CACHECMD_PATH=" + e.Path,
+		"CACHECMD_AGE_SECONDS=" + strconv.Itoa(e.AgeSeconds),
+		"CACHECMD_RUNTIME_SECONDS=" + strconv.FormatFloat(e.RuntimeSeconds, 'f', 3, 64),
+	}
+}
+
+// hookTimeout is timeout of webhook requests.
+const hookTimeout = 10 * time.Second
+
+// runHook runs hook, which is a shell command or a webhook URL, with the
+// given event.
+func runHook(hook string, event hookEvent) error {
+	if strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://") {
+		return postWebhook(hook, event)
+	}
+	cmd := shellCommand(hook)
+	cmd.Env = append(os.Environ(), event.env()...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hook %q failed: %v", hook, err)
+	}
+	return nil
+}
+
+// runEventHook runs hook of the command with the given event if hook is set.
+// Errors are reported to stderr and do not change the result of cachecmd.
+func (c *CacheCmd) runEventHook(hook string, event hookEvent) {
+	if hook == "" {
+		return
+	}
+	event.Command = append([]string{c.cmdName}, c.cmdArgs...)
+	event.Key = c.opt.cacheKey
+	if err := runHook(hook, event); err != nil {
+		fmt.Fprintf(c.stderr, "cachecmd: %v\n", err)
+	}
+}
+
+func postWebhook(url string, event hookEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: hookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("webhook failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook failed: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunHook_command(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	out := filepath.Join(tmpdir, "out")
+
+	event := hookEvent{Event: "refresh_error", Command: []string{"echo", "1"}, ExitCode: 2, Failures: 3}
+	hook := `echo "$CACHECMD_EVENT $CACHECMD_COMMAND $CACHECMD_EXIT_CODE $CACHECMD_FAILURES" > ` + out
+	if err := runHook(hook, event); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(out)
+	if got, want := string(b), "refresh_error echo 1 2 3\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if err := runHook("exit 1", event); err == nil {
+		t.Error("got nil error for failing hook")
+	}
+}
+
+func TestRunHook_webhook(t *testing.T) {
+	var got hookEvent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer ts.Close()
+
+	event := hookEvent{Event: "refresh_error", Command: []string{"echo", "1"}, ExitCode: 2, Failures: 3}
+	if err := runHook(ts.URL, event); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, event) {
+		t.Errorf("got %#v, want %#v", got, event)
+	}
+}
+
+func TestCacheCmd_recordRefreshResult(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	out := filepath.Join(tmpdir, "out")
+	c := CacheCmd{
+		cmdName: "false",
+		opt: option{
+			cacheDir:            tmpdir,
+			onRefreshError:      "echo $CACHECMD_FAILURES >> " + out,
+			onRefreshErrorAfter: 2,
+		},
+	}
+	for _, code := range []int{1, 1, 1, 0, 1} {
+		if err := c.recordRefreshResult(code, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, _ := ioutil.ReadFile(out)
+	if got, want := string(b), "2\n3\n"; got != want {
+		t.Errorf("got failures %q, want %q", got, want)
+	}
+}
+
+func TestCacheCmd_Run_eventHooks(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	out := filepath.Join(tmpdir, "out")
+	hook := `echo "$CACHECMD_EVENT $CACHECMD_COMMAND" >> ` + out
+	for i := 0; i < 2; i++ {
+		cachecmd := CacheCmd{
+			stdout:  ioutil.Discard,
+			stderr:  ioutil.Discard,
+			cmdName: "echo",
+			cmdArgs: []string{"1"},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir, onHit: hook, onMiss: hook, onStore: hook},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, _ := ioutil.ReadFile(out)
+	if got, want := string(b), "miss echo 1\nstore echo 1\nhit echo 1\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
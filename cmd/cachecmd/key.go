@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// buildCacheKey returns the cache key which mixes -key with values derived
+// from -key-* flags. It returns -key as is if no -key-* flags are set, so
+// existing caches keep working. cmdName is the name of the command to run.
+func buildCacheKey(opt option, cmdName string) (string, error) {
+	parts := []string{opt.cacheKey}
+	if opt.keyCwd {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("failed to get current directory: %v", err)
+		}
+		parts = append(parts, "cwd="+wd)
+	}
+	for _, name := range splitList(opt.keyEnv) {
+		if v, ok := os.LookupEnv(name); ok {
+			parts = append(parts, fmt.Sprintf("env:%s=%s", name, v))
+		} else {
+			parts = append(parts, fmt.Sprintf("env:%s unset", name))
+		}
+	}
+	for _, name := range splitList(opt.keyFile) {
+		part, err := fileKey(name)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	if opt.keyCmd != "" {
+		part, err := cmdKey(opt.keyCmd)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	if opt.keyGit {
+		part, err := gitKey()
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	if opt.runner != "" {
+		parts = append(parts, "runner="+opt.runner)
+	}
+	if opt.keyExec {
+		part, err := execKey(cmdName)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+// fileKey returns cache key part for contents of the given file. Missing file
+// is a valid state and it does not return error for it.
+func fileKey(name string) (string, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return fmt.Sprintf("file:%s missing", name), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open key file: %v", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read key file: %v", err)
+	}
+	return fmt.Sprintf("file:%s=%x", name, h.Sum(nil)), nil
+}
+
+// splitList splits comma separated flag value and drops empty elements.
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// cmdKey returns cache key part for output of the given shell command.
+func cmdKey(command string) (string, error) {
+	cmd := shellCommand(command)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run key command %q: %v", command, err)
+	}
+	return fmt.Sprintf("cmd:%s=%x", command, sha256.Sum256(out)), nil
+}
+
+// gitKey returns cache key part for the git repository of current directory.
+// It consists of repository root, HEAD commit and hash of dirty state, which
+// includes contents of untracked files.
+func gitKey() (string, error) {
+	root, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		// Not inside git repository.
+		return "git: none", nil
+	}
+	// HEAD does not exist in repository without commits.
+	head, _ := exec.Command("git", "rev-parse", "--verify", "-q", "HEAD").Output()
+	status, err := exec.Command("git", "status", "--porcelain").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run git status: %v", err)
+	}
+	h := sha256.New()
+	h.Write(status)
+	if len(status) > 0 && len(head) > 0 {
+		diff, err := exec.Command("git", "diff", "HEAD").Output()
+		if err != nil {
+			return "", fmt.Errorf("failed to run git diff: %v", err)
+		}
+		h.Write(diff)
+	}
+	if len(status) > 0 {
+		if err := hashUntracked(h, strings.TrimSpace(string(root))); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("git:%s@%s dirty=%x",
+		strings.TrimSpace(string(root)), strings.TrimSpace(string(head)), h.Sum(nil)), nil
+}
+
+// hashUntracked writes names and contents of untracked files in the git
+// repository of root to h. git status and git diff only have their names.
+func hashUntracked(h io.Writer, root string) error {
+	out, err := exec.Command("git", "-C", root, "ls-files", "-o", "--exclude-standard", "-z").Output()
+	if err != nil {
+		return fmt.Errorf("failed to run git ls-files: %v", err)
+	}
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name == "" {
+			continue
+		}
+		fmt.Fprintf(h, "\nuntracked:%d:%s", len(name), name)
+		p := filepath.Join(root, name)
+		fi, err := os.Lstat(p)
+		if err != nil {
+			// File removed after listing.
+			continue
+		}
+		switch {
+		case fi.IsDir():
+			// Nested repository or submodule.
+			fmt.Fprint(h, " dir")
+			continue
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, _ := os.Readlink(p)
+			fmt.Fprintf(h, " symlink=%s", target)
+			continue
+		case !fi.Mode().IsRegular():
+			fmt.Fprintf(h, " mode=%v", fi.Mode())
+			continue
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			continue
+		}
+		fh := sha256.New()
+		_, err = io.Copy(fh, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read untracked file: %v", err)
+		}
+		fmt.Fprintf(h, "=%x", fh.Sum(nil))
+	}
+	return nil
+}
+
+// execKey returns cache key part for the executable of the given command. The
+// key changes when the executable is replaced (e.g. upgraded).
+func execKey(cmdName string) (string, error) {
+	path, err := exec.LookPath(cmdName)
+	if err != nil {
+		// Let running the command report the error.
+		return fmt.Sprintf("exec:%s missing", cmdName), nil
+	}
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		path = p
+	}
+	if p, err := filepath.Abs(path); err == nil {
+		path = p
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat executable: %v", err)
+	}
+	return fmt.Sprintf("exec:%s mtime=%d size=%d",
+		path, stat.ModTime().UnixNano(), stat.Size()), nil
+}
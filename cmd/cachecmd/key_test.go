@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildCacheKey(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("CACHECMD_TEST_KEY_ENV", "v")
+	defer os.Unsetenv("CACHECMD_TEST_KEY_ENV")
+
+	tests := []struct {
+		name string
+		opt  option
+		want string
+	}{
+		{
+			name: "no key",
+			opt:  option{},
+			want: "",
+		},
+		{
+			name: "only -key",
+			opt:  option{cacheKey: "key"},
+			want: "key",
+		},
+		{
+			name: "-key-cwd",
+			opt:  option{keyCwd: true},
+			want: "\ncwd=" + wd,
+		},
+		{
+			name: "-key and -key-cwd",
+			opt:  option{cacheKey: "key", keyCwd: true},
+			want: "key\ncwd=" + wd,
+		},
+		{
+			name: "-key-env",
+			opt:  option{keyEnv: "CACHECMD_TEST_KEY_ENV, CACHECMD_TEST_UNSET,"},
+			want: "\nenv:CACHECMD_TEST_KEY_ENV=v\nenv:CACHECMD_TEST_UNSET unset",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := buildCacheKey(tt.opt, "date")
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildCacheKey_keyFile(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	fname := filepath.Join(tmpdir, "go.mod")
+	missing := filepath.Join(tmpdir, "go.sum")
+	opt := option{keyFile: fname + "," + missing}
+
+	keyOf := func(content string) string {
+		if err := ioutil.WriteFile(fname, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		key, err := buildCacheKey(opt, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	key1 := keyOf("module a")
+	if key2 := keyOf("module a"); key1 != key2 {
+		t.Errorf("got different keys for the same contents: %q, %q", key1, key2)
+	}
+	if key3 := keyOf("module b"); key1 == key3 {
+		t.Errorf("got the same key for different contents: %q", key1)
+	}
+}
+
+func TestBuildCacheKey_keyCmd(t *testing.T) {
+	key1, err := buildCacheKey(option{keyCmd: "echo 1"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, err := buildCacheKey(option{keyCmd: "echo 2"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key1 == key2 {
+		t.Errorf("got the same key for different outputs: %q", key1)
+	}
+
+	if _, err := buildCacheKey(option{keyCmd: "exit 1"}, ""); err == nil {
+		t.Error("got nil error for failing key command")
+	}
+}
+
+func TestBuildCacheKey_keyGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(tmpdir); err != nil {
+		t.Fatal(err)
+	}
+
+	opt := option{keyGit: true}
+	outside, err := buildCacheKey(opt, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exec.Command("git", "init", "-q").Run(); err != nil {
+		t.Fatal(err)
+	}
+	clean, err := buildCacheKey(opt, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("a.txt", []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dirty, err := buildCacheKey(opt, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outside == clean || clean == dirty {
+		t.Errorf("got the same keys: outside=%q, clean=%q, dirty=%q", outside, clean, dirty)
+	}
+	// Changes of untracked files are not in git status nor git diff.
+	if err := ioutil.WriteFile("a.txt", []byte("b"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := buildCacheKey(opt, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed == dirty {
+		t.Errorf("got the same keys after changing untracked file: %q", changed)
+	}
+	// Untracked nested repository is listed as a directory.
+	if err := exec.Command("git", "init", "-q", "sub").Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join("sub", "b.txt"), []byte("b"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	nested, err := buildCacheKey(opt, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nested == changed {
+		t.Errorf("got the same keys after adding nested repository: %q", nested)
+	}
+}
+
+func TestBuildCacheKey_keyExec(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	bin := filepath.Join(tmpdir, "mycmd")
+	opt := option{keyExec: true}
+
+	keyOf := func(content string, mtime time.Time) string {
+		if err := ioutil.WriteFile(bin, []byte(content), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(bin, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		key, err := buildCacheKey(opt, bin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	now := time.Now()
+	key1 := keyOf("#!/bin/sh\n", now)
+	if key2 := keyOf("#!/bin/sh\n", now); key1 != key2 {
+		t.Errorf("got different keys for the same executable: %q, %q", key1, key2)
+	}
+	if key3 := keyOf("#!/bin/sh\n", now.Add(time.Second)); key1 == key3 {
+		t.Errorf("got the same key for updated executable: %q", key1)
+	}
+}
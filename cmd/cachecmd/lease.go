@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// When many machines sharing -backend miss the same entry at once (e.g. cron
+// jobs), -jitter spreads them and -lease lets only one of them run the command
+// while the others wait for its result in the backend. A lease is a file next
+// to the entry in the backend which holds the holder and the expiry time in
+// Unix seconds.
+
+// leasePollInterval is the interval of checking the backend for the result of
+// the lease holder.
+var leasePollInterval = time.Second
+
+// leaser is implemented by backends which support leases.
+type leaser interface {
+	// acquire takes the lease of the given name for ttl. It returns false if
+	// other holder has the unexpired lease.
+	acquire(name, holder string, ttl time.Duration) (bool, error)
+	// release releases the lease of the given name if it's held by holder.
+	release(name, holder string) error
+}
+
+// leaseName returns name of the lease of the entry name in backend.
+func leaseName(name string) string {
+	return strings.TrimSuffix(name, ".ENTRY") + ".LEASE"
+}
+
+// avoidHerd waits for -jitter and the lease holder of -lease before running
+// the command of the given base path. It returns true with the result of the
+// cache if other machine stores the entry to the backend in the meantime.
+// Otherwise, it returns func to release the lease after the entry is stored.
+func (c *CacheCmd) avoidHerd(remote backend, base string) (release func(), code int, ok bool, err error) {
+	release = func() {}
+	useRemote := func() bool {
+		if err := c.pullEntry(remote, base); err != nil {
+			fmt.Fprintf(c.stderr, "cachecmd: %v\n", err)
+		}
+		if !c.shouldUseCache(base) {
+			return false
+		}
+		code, err = c.replayHit(base)
+		return err != errBrokenCache
+	}
+	if c.opt.jitter > 0 {
+		time.Sleep(time.Duration(rand.New(rand.NewSource(time.Now().UnixNano())).Int63n(int64(c.opt.jitter))))
+		if useRemote() {
+			return release, code, true, err
+		}
+	}
+	l, isLeaser := remote.(leaser)
+	if c.opt.lease <= 0 || !isLeaser {
+		return release, 0, false, nil
+	}
+	name, holder := leaseName(c.remoteName(base)), lockOwner()
+	deadline := time.Now().Add(c.opt.lease)
+	for time.Now().Before(deadline) {
+		acquired, err := l.acquire(name, holder, c.opt.lease)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "cachecmd: failed to take lease in backend: %v\n", err)
+			return release, 0, false, nil
+		}
+		if acquired {
+			// Store the entry before releasing the lease so that others
+			// can use it.
+			c.opt.backendSync = true
+			return func() {
+				if err := l.release(name, holder); err != nil {
+					fmt.Fprintf(c.stderr, "cachecmd: failed to release lease in backend: %v\n", err)
+				}
+			}, 0, false, nil
+		}
+		time.Sleep(leasePollInterval)
+		if useRemote() {
+			return release, code, true, err
+		}
+	}
+	// The holder did not store the entry in time.
+	return release, 0, false, nil
+}
+
+// parseLease parses content of a lease file.
+func parseLease(b []byte) (holder string, expiry time.Time) {
+	fields := strings.Fields(string(b))
+	if len(fields) != 2 {
+		return "", time.Time{}
+	}
+	sec, _ := strconv.ParseInt(fields[1], 10, 64)
+	return fields[0], time.Unix(sec, 0)
+}
+
+func (d dirBackend) acquire(name, holder string, ttl time.Duration) (bool, error) {
+	p := filepath.Join(d.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return false, err
+	}
+	for i := 0; i < 2; i++ {
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%s %d\n", holder, time.Now().Add(ttl).Unix())
+			if errClose := f.Close(); err == nil {
+				err = errClose
+			}
+			return err == nil, err
+		}
+		if !os.IsExist(err) {
+			return false, err
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		if _, expiry := parseLease(b); err == nil && time.Now().Before(expiry) {
+			return false, nil
+		}
+		// Remove expired lease and retry.
+		os.Remove(p)
+	}
+	return false, nil
+}
+
+func (d dirBackend) release(name, holder string) error {
+	p := filepath.Join(d.dir, filepath.FromSlash(name))
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if h, _ := parseLease(b); h != holder {
+		return nil
+	}
+	return os.Remove(p)
+}
+
+func (b *sshBackend) acquire(name, holder string, ttl time.Duration) (bool, error) {
+	p := shellQuote(path.Join(b.dir, name))
+	now := time.Now()
+	lease := shellQuote(fmt.Sprintf("%s %d", holder, now.Add(ttl).Unix()))
+	// noclobber makes the redirection fail if the lease exists.
+	take := fmt.Sprintf("(set -C; echo %s > %s) 2>/dev/null && exit 0", lease, p)
+	cmd := b.command(fmt.Sprintf("mkdir -p %s; %s; read h e < %s; [ \"${e:-0}\" -lt %d ] || exit %d; rm -f %s; %s; exit %d",
+		shellQuote(path.Dir(path.Join(b.dir, name))), take, p, now.Unix(), exitCodeSSHNotFound, p, take, exitCodeSSHNotFound))
+	err := cmd.Run()
+	if exiterr, ok := err.(*exec.ExitError); ok && exiterr.ExitCode() == exitCodeSSHNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ssh failed: %v", err)
+	}
+	return true, nil
+}
+
+func (b *sshBackend) release(name, holder string) error {
+	p := shellQuote(path.Join(b.dir, name))
+	cmd := b.command(fmt.Sprintf("read h e < %s 2>/dev/null || exit 0; [ \"$h\" = %s ] && rm -f %s; exit 0", p, shellQuote(holder), p))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ssh failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testLeaser(t *testing.T, l leaser) {
+	t.Helper()
+	if ok, err := l.acquire("ns/a.LEASE", "1@a", time.Minute); !ok || err != nil {
+		t.Fatalf("acquire got (%v, %v), want the lease", ok, err)
+	}
+	if ok, err := l.acquire("ns/a.LEASE", "2@b", time.Minute); ok || err != nil {
+		t.Errorf("acquire got (%v, %v), want the lease held by other", ok, err)
+	}
+	// Release by others does nothing.
+	if err := l.release("ns/a.LEASE", "2@b"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := l.acquire("ns/a.LEASE", "2@b", time.Minute); ok {
+		t.Error("lease is released by other holder")
+	}
+	if err := l.release("ns/a.LEASE", "1@a"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := l.acquire("ns/a.LEASE", "2@b", -time.Second); !ok || err != nil {
+		t.Fatalf("acquire got (%v, %v) after release, want the lease", ok, err)
+	}
+	if ok, err := l.acquire("ns/a.LEASE", "1@a", time.Minute); !ok || err != nil {
+		t.Errorf("acquire got (%v, %v), want expired lease", ok, err)
+	}
+}
+
+func TestDirBackend_lease(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	testLeaser(t, dirBackend{dir: tmpdir})
+}
+
+func TestCacheCmd_Run_lease(t *testing.T) {
+	defer func(d time.Duration) { leasePollInterval = d }(leasePollInterval)
+	leasePollInterval = 10 * time.Millisecond
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	remote := filepath.Join(tmpdir, "remote")
+	count := filepath.Join(tmpdir, "count")
+
+	const machines = 5
+	outputs := make([]string, machines)
+	var wg sync.WaitGroup
+	for i := 0; i < machines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stdout := new(bytes.Buffer)
+			cachecmd := CacheCmd{
+				stdout:  stdout,
+				stderr:  ioutil.Discard,
+				cmdName: "sh",
+				cmdArgs: []string{"-c", "echo x >> " + count + "; sleep 0.2; date +%N"},
+				opt: option{ttl: time.Minute, cacheDir: filepath.Join(tmpdir, "local", string(rune('a'+i))),
+					namespace: "ns", backend: "file://" + filepath.ToSlash(remote),
+					lease: 10 * time.Second, jitter: 10 * time.Millisecond},
+			}
+			if _, err := cachecmd.Run(context.TODO()); err != nil {
+				t.Error(err)
+			}
+			outputs[i] = stdout.String()
+		}(i)
+	}
+	wg.Wait()
+	if b, _ := ioutil.ReadFile(count); strings.Count(string(b), "x") != 1 {
+		t.Errorf("command ran %d times, want once", strings.Count(string(b), "x"))
+	}
+	for i, out := range outputs {
+		if out != outputs[0] {
+			t.Errorf("machine %d got %q, want %q", i, out, outputs[0])
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(remote, "ns", "*.LEASE")); len(files) != 0 {
+		t.Errorf("lease is not released: %v", files)
+	}
+}
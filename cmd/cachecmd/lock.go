@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lock modes of -lock-mode.
+const (
+	// Use flock on local file systems and lock files on network file systems.
+	lockAuto = "auto"
+	// Use flock(2), which is released when the holder dies.
+	lockFlock = "flock"
+	// Use lock files created with O_EXCL, which is atomic on NFS too.
+	lockLockfile = "lockfile"
+	// Do not lock.
+	lockNone = "none"
+)
+
+// lockStaleAge is age of a lock file held by a process on other host after
+// which the lock file is regarded as stale. Whether the holder is running
+// cannot be checked.
+const lockStaleAge = time.Hour
+
+// lockFile represents a lock file which indicates the command of a cache
+// entry is running. It contains PID of the process which holds the lock and
+// the hostname.
+type lockFile struct {
+	path string
+	// f is the file locked by flock.
+	f *os.File
+}
+
+// resolveLockMode returns lock mode to use for path.
+func resolveLockMode(mode, path string) string {
+	switch mode {
+	case "", lockAuto:
+		if !flockSupported || isNetworkFS(filepath.Dir(path)) {
+			return lockLockfile
+		}
+		return lockFlock
+	}
+	return mode
+}
+
+// validLockMode reports whether mode is valid value of -lock-mode.
+func validLockMode(mode string) error {
+	switch mode {
+	case "", lockAuto, lockLockfile, lockNone:
+		return nil
+	case lockFlock:
+		if !flockSupported {
+			return fmt.Errorf("-lock-mode=flock is not supported on this platform")
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid -lock-mode: %q", mode)
+}
+
+// tryLock tries to acquire the lock file without blocking. It returns nil
+// lockFile if other running process holds the lock. A lock file left by a
+// process which no longer exists is taken over. The lock file is created with
+// permission perm.
+func tryLock(path, mode string, perm os.FileMode) (*lockFile, error) {
+	switch resolveLockMode(mode, path) {
+	case lockNone:
+		return &lockFile{}, nil
+	case lockFlock:
+		f, err := flockTry(path, perm)
+		if err != nil || f == nil {
+			return nil, err
+		}
+		writeLockOwner(f)
+		return &lockFile{path: path, f: f}, nil
+	}
+	for i := 0; i < 2; i++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if err == nil {
+			defer f.Close()
+			if err := writeLockOwner(f); err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock file: %v", err)
+			}
+			return &lockFile{path: path}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lock file: %v", err)
+		}
+		if isLocked(path, lockLockfile) {
+			return nil, nil
+		}
+		// Remove stale lock file and retry.
+		os.Remove(path)
+	}
+	return nil, nil
+}
+
+// writeLockOwner writes PID and hostname of cachecmd to the lock file.
+func writeLockOwner(f *os.File) error {
+	_, err := f.WriteString(lockOwner())
+	return err
+}
+
+// lockOwner returns PID and hostname of cachecmd like 123@host.
+func lockOwner() string {
+	owner := strconv.Itoa(os.Getpid())
+	if host, err := os.Hostname(); err == nil {
+		owner += "@" + host
+	}
+	return owner
+}
+
+func (l *lockFile) unlock() error {
+	if l.path == "" {
+		return nil
+	}
+	// Remove the file before releasing flock, otherwise other process may lock
+	// the file which is about to be removed.
+	err := os.Remove(l.path)
+	if l.f != nil {
+		l.f.Close()
+	}
+	return err
+}
+
+// isLocked reports whether the lock file exists and its holder is running.
+func isLocked(path, mode string) bool {
+	switch resolveLockMode(mode, path) {
+	case lockNone:
+		return false
+	case lockFlock:
+		return flockHeld(path)
+	}
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	owner := strings.TrimSpace(string(b))
+	if i := strings.LastIndex(owner, "@"); i >= 0 {
+		host, herr := os.Hostname()
+		if herr != nil || owner[i+1:] != host {
+			// The holder runs on other host which shares the file system.
+			return fi == nil || time.Since(fi.ModTime()) < lockStaleAge
+		}
+		owner = owner[:i]
+	}
+	pid, err := strconv.Atoi(owner)
+	if err != nil {
+		// The holder may be writing PID right now.
+		return true
+	}
+	return processExists(pid)
+}
+
+// waitUnlock waits for the lock file to be released. It returns false if
+// timeout exceeded.
+func waitUnlock(path, mode string, timeout time.Duration) bool {
+	const interval = 50 * time.Millisecond
+	deadline := time.Now().Add(timeout)
+	for isLocked(path, mode) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(interval)
+	}
+	return true
+}
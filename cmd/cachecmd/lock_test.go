@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testLockModes returns lock modes which lock on this platform.
+func testLockModes() []string {
+	if flockSupported {
+		return []string{lockLockfile, lockFlock}
+	}
+	return []string{lockLockfile}
+}
+
+func TestTryLock(t *testing.T) {
+	for _, mode := range testLockModes() {
+		t.Run(mode, func(t *testing.T) {
+			tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+			defer os.RemoveAll(tmpdir)
+			path := filepath.Join(tmpdir, "a.LOCK")
+
+			lock, err := tryLock(path, mode, defaultFileMode)
+			if err != nil || lock == nil {
+				t.Fatalf("tryLock() = %v, %v, want lock", lock, err)
+			}
+			if l, err := tryLock(path, mode, defaultFileMode); err != nil || l != nil {
+				t.Errorf("tryLock() for locked file = %v, %v, want nil", l, err)
+			}
+			if !isLocked(path, mode) {
+				t.Error("isLocked() = false, want true")
+			}
+			if err := lock.unlock(); err != nil {
+				t.Fatal(err)
+			}
+			if isLocked(path, mode) {
+				t.Error("isLocked() after unlock = true, want false")
+			}
+			if fileexists(path) {
+				t.Error("lock file exists after unlock")
+			}
+		})
+	}
+}
+
+func TestTryLock_stale(t *testing.T) {
+	for _, mode := range testLockModes() {
+		t.Run(mode, func(t *testing.T) {
+			tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+			defer os.RemoveAll(tmpdir)
+			path := filepath.Join(tmpdir, "a.LOCK")
+
+			// PID which should not exist.
+			if err := ioutil.WriteFile(path, []byte(fmt.Sprint(1<<30)), 0600); err != nil {
+				t.Fatal(err)
+			}
+			lock, err := tryLock(path, mode, defaultFileMode)
+			if err != nil || lock == nil {
+				t.Fatalf("tryLock() for stale lock = %v, %v, want lock", lock, err)
+			}
+			lock.unlock()
+		})
+	}
+}
+
+func TestTryLock_otherHost(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	path := filepath.Join(tmpdir, "a.LOCK")
+
+	// The PID does not exist on this host, but the holder may run on the other.
+	owner := fmt.Sprintf("%d@cachecmd-other-host.invalid", 1<<30)
+	if err := ioutil.WriteFile(path, []byte(owner), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := tryLock(path, lockLockfile, defaultFileMode); err != nil || l != nil {
+		t.Errorf("tryLock() for lock of other host = %v, %v, want nil", l, err)
+	}
+
+	old := time.Now().Add(-lockStaleAge - time.Minute)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := tryLock(path, lockLockfile, defaultFileMode)
+	if err != nil || lock == nil {
+		t.Fatalf("tryLock() for old lock of other host = %v, %v, want lock", lock, err)
+	}
+	lock.unlock()
+}
+
+func TestTryLock_none(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	path := filepath.Join(tmpdir, "a.LOCK")
+
+	l1, err := tryLock(path, lockNone, defaultFileMode)
+	if err != nil || l1 == nil {
+		t.Fatalf("tryLock() = %v, %v, want lock", l1, err)
+	}
+	l2, err := tryLock(path, lockNone, defaultFileMode)
+	if err != nil || l2 == nil {
+		t.Fatalf("tryLock() = %v, %v, want lock", l2, err)
+	}
+	if isLocked(path, lockNone) || fileexists(path) {
+		t.Error("lock file is created with -lock-mode=none")
+	}
+	if err := l1.unlock(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidLockMode(t *testing.T) {
+	for _, mode := range []string{"", lockAuto, lockLockfile, lockNone} {
+		if err := validLockMode(mode); err != nil {
+			t.Errorf("validLockMode(%q) = %v", mode, err)
+		}
+	}
+	if err := validLockMode("fcntl"); err == nil {
+		t.Error("validLockMode(fcntl) = nil, want error")
+	}
+}
+
+func TestWaitUnlock(t *testing.T) {
+	for _, mode := range testLockModes() {
+		t.Run(mode, func(t *testing.T) {
+			tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+			defer os.RemoveAll(tmpdir)
+			path := filepath.Join(tmpdir, "a.LOCK")
+
+			lock, err := tryLock(path, mode, defaultFileMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if waitUnlock(path, mode, 100*time.Millisecond) {
+				t.Error("waitUnlock() = true, want timeout")
+			}
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				lock.unlock()
+			}()
+			if !waitUnlock(path, mode, 10*time.Second) {
+				t.Error("waitUnlock() = false, want true")
+			}
+		})
+	}
+}
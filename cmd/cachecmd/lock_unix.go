@@ -0,0 +1,55 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+const flockSupported = true
+
+// flockTry locks path by flock without blocking. It returns nil file if other
+// process holds the lock. The file is created with permission perm. Lock files
+// which other users created can be locked if they are readable.
+func flockTry(path string, perm os.FileMode) (*os.File, error) {
+	for i := 0; i < 3; i++ {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, perm)
+		if os.IsPermission(err) {
+			f, err = os.Open(path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open lock file: %v", err)
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			f.Close()
+			if err == syscall.EWOULDBLOCK {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to lock: %v", err)
+		}
+		// The previous holder may have removed the file after it was opened.
+		fi, err := f.Stat()
+		if pi, errPath := os.Stat(path); err == nil && errPath == nil && os.SameFile(fi, pi) {
+			f.Truncate(0)
+			return f, nil
+		}
+		f.Close()
+	}
+	return nil, nil
+}
+
+// flockHeld reports whether other process holds flock of path.
+func flockHeld(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return !os.IsNotExist(err)
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err != nil {
+		return err == syscall.EWOULDBLOCK
+	}
+	return false
+}
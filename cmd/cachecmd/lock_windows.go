@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+const flockSupported = false
+
+func flockTry(path string, perm os.FileMode) (*os.File, error) {
+	return nil, errors.New("flock is not supported")
+}
+
+func flockHeld(path string) bool {
+	return false
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func runLs(args []string) (int, error) {
+	fs := newSubFlagSet("ls", "cachecmd ls [-porcelain [-null]] [flags]",
+		"cachecmd ls lists cache entries in the cache directory or namespace with cached time,\n"+
+			"exit code, runtime, the number of cache hits and misses, the last hit time and the command.")
+	porcelain := fs.Bool("porcelain", false,
+		"list entries in stable tab-separated columns for scripts: path of the entry file, cached time in Unix time, exit code, runtime in milliseconds, the command, the number of hits, the number of misses and the last hit time in Unix time. Columns of unknown values of broken entries and the last hit time of entries never hit are empty.")
+	null := fs.Bool("null", false, "terminate entries of -porcelain by NUL instead of newline.")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	dir, err := optionCacheDir(*flagOpt)
+	if err != nil {
+		return 2, err
+	}
+	switch {
+	case *null && !*porcelain:
+		return 2, errors.New("-null requires -porcelain")
+	case *porcelain:
+		err = listEntriesPorcelain(os.Stdout, dir, *null)
+	default:
+		err = listEntries(os.Stdout, dir)
+	}
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// walkEntries calls fn for cache entries in dir with metadata or the error of
+// reading it.
+func walkEntries(dir string, fn func(path string, fi os.FileInfo, meta entryMeta, err error)) error {
+	fileinfos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, fi := range fileinfos {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".ENTRY") {
+			continue
+		}
+		path := filepath.Join(dir, fi.Name())
+		meta, err := readMeta(path)
+		fn(path, fi, meta, err)
+	}
+	return nil
+}
+
+// listEntries writes cache entries in dir to w. Broken entries are listed
+// with the error instead of metadata.
+func listEntries(w io.Writer, dir string) error {
+	return walkEntries(dir, func(path string, fi os.FileInfo, meta entryMeta, err error) {
+		if err != nil {
+			fmt.Fprintf(w, "%s\terror=%v\t%s\n", fi.ModTime().Format(time.RFC3339), err, fi.Name())
+			return
+		}
+		a := readAccess(strings.TrimSuffix(path, ".ENTRY"))
+		lastHit := "-"
+		if !a.lastHit.IsZero() {
+			lastHit = a.lastHit.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\texit=%d\truntime=%v\thits=%d\tmisses=%d\tlast-hit=%s\t%s\n", fi.ModTime().Format(time.RFC3339),
+			meta.ExitCode, meta.Runtime.Round(time.Millisecond), a.hits, a.misses, lastHit, entryCommand(meta, fi.Name()))
+	})
+}
+
+// listEntriesPorcelain writes cache entries in dir to w for -porcelain. Tabs
+// in the command are replaced with spaces and so are newlines unless null.
+func listEntriesPorcelain(w io.Writer, dir string, null bool) error {
+	term, blank := "\n", "\t\n"
+	if null {
+		term, blank = "\x00", "\t"
+	}
+	return walkEntries(dir, func(path string, fi os.FileInfo, meta entryMeta, err error) {
+		exitCode, runtime := "", ""
+		if err == nil {
+			exitCode = strconv.Itoa(meta.ExitCode)
+			runtime = strconv.FormatInt(int64(meta.Runtime/time.Millisecond), 10)
+		}
+		command := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(blank, r) {
+				return ' '
+			}
+			return r
+		}, entryCommand(meta, fi.Name()))
+		a := readAccess(strings.TrimSuffix(path, ".ENTRY"))
+		lastHit := ""
+		if !a.lastHit.IsZero() {
+			lastHit = strconv.FormatInt(a.lastHit.Unix(), 10)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%d\t%d\t%s%s", path, fi.ModTime().Unix(), exitCode, runtime, command,
+			a.hits, a.misses, lastHit, term)
+	})
+}
+
+// entryCommand returns the command of the entry. It returns the file name for
+// entries written before the command is stored in metadata.
+func entryCommand(meta entryMeta, name string) string {
+	if len(meta.Command) == 0 {
+		return name
+	}
+	return strings.Join(meta.Command, " ")
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListEntries(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "sh",
+		cmdArgs: []string{"-c", "exit 3"},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir},
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpdir, "v4-broken.ENTRY"), []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := listEntries(buf, tmpdir); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), buf.String())
+	}
+	var found bool
+	for _, line := range lines {
+		if strings.Contains(line, "\texit=3\truntime=") && strings.Contains(line, "\thits=1\tmisses=1\tlast-hit=2") &&
+			strings.HasSuffix(line, "\tsh -c exit 3") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("entry of the command is not listed: %q", buf.String())
+	}
+	if !strings.Contains(buf.String(), "\terror=") {
+		t.Errorf("broken entry is not listed with error: %q", buf.String())
+	}
+}
+
+func TestListEntriesPorcelain(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "sh",
+		cmdArgs: []string{"-c", "echo\ta\nexit 3"},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir},
+	}
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	path := cachecmd.cacheFilePath() + ".ENTRY"
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := fmt.Sprintf("%s\t%d\t3\t", path, fi.ModTime().Unix())
+
+	buf := new(bytes.Buffer)
+	if err := listEntriesPorcelain(buf, tmpdir, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.HasPrefix(got, prefix) || !strings.HasSuffix(got, "\tsh -c echo a exit 3\t0\t1\t\n") {
+		t.Errorf("got %q, want %q...", got, prefix)
+	}
+
+	buf.Reset()
+	if err := listEntriesPorcelain(buf, tmpdir, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.HasPrefix(got, prefix) || !strings.HasSuffix(got, "\tsh -c echo a\nexit 3\t0\t1\t\x00") {
+		t.Errorf("got %q with -null, want %q...", got, prefix)
+	}
+	if fields := strings.Split(strings.TrimSuffix(buf.String(), "\x00"), "\t"); len(fields) != 8 {
+		t.Errorf("got %d columns, want 8: %q", len(fields), fields)
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"flag"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 )
@@ -65,7 +67,7 @@ func TestCacheCmd_Run(t *testing.T) {
 			cmdArgs: args,
 			opt:     tt.opt1,
 
-			currentTime: now,
+			clock: fixedClock(now),
 		}
 
 		if _, err := cachecmd.Run(context.TODO()); err != nil {
@@ -76,7 +78,7 @@ func TestCacheCmd_Run(t *testing.T) {
 		stdout2 := new(bytes.Buffer)
 		cachecmd.stdout = stdout2
 		cachecmd.opt = tt.opt2
-		cachecmd.currentTime = now.Add(tt.interval)
+		cachecmd.clock = fixedClock(now.Add(tt.interval))
 
 		if _, err := cachecmd.Run(context.TODO()); err != nil {
 			t.Errorf("unexpected error w/ second run: %v", err)
@@ -117,6 +119,250 @@ func TestCacheCmd_Run_notfound(t *testing.T) {
 	}
 }
 
+func TestCacheCmd_Run_stdin(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	stdout := new(bytes.Buffer)
+	cachecmd := CacheCmd{
+		stdin:   strings.NewReader("foo\nbar\n"),
+		stdout:  stdout,
+		stderr:  ioutil.Discard,
+		cmdName: "grep",
+		cmdArgs: []string{"foo"},
+		opt:     option{ttl: 1 * time.Minute, cacheDir: tmpdir},
+	}
+
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if got := stdout.String(); got != "foo\n" {
+		t.Errorf("got %q, want %q", got, "foo\n")
+	}
+}
+
+func TestCacheCmd_Run_stdinData(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+
+	runWithStdin := func(stdin string) string {
+		stdout := new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:    stdout,
+			stderr:    ioutil.Discard,
+			cmdName:   "sh",
+			cmdArgs:   []string{"-c", "cat; date +%N"},
+			opt:       option{ttl: 1 * time.Minute, cacheDir: tmpdir},
+			stdinData: []byte(stdin),
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		return stdout.String()
+	}
+
+	foo1 := runWithStdin("foo\n")
+	if !strings.HasPrefix(foo1, "foo\n") {
+		t.Errorf("got %q, want stdin to be passed to the command", foo1)
+	}
+	bar := runWithStdin("bar\n")
+	if !strings.HasPrefix(bar, "bar\n") {
+		t.Errorf("got %q, want result for different stdin", bar)
+	}
+	if foo2 := runWithStdin("foo\n"); foo1 != foo2 {
+		t.Errorf("got %q, want cached result %q", foo2, foo1)
+	}
+}
+
+func TestCacheCmd_Run_inflight(t *testing.T) {
+	tests := []struct {
+		inflight  string
+		wantCache bool
+	}{
+		{inflight: inflightRun, wantCache: false},
+		{inflight: inflightWait, wantCache: false},
+		{inflight: inflightStale, wantCache: true},
+		{inflight: inflightTail, wantCache: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.inflight, func(t *testing.T) {
+			tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+			defer os.RemoveAll(tmpdir)
+			now := time.Now()
+			cachecmd := CacheCmd{
+				stderr:  ioutil.Discard,
+				cmdName: "date",
+				cmdArgs: []string{`+%N`},
+				opt: option{
+					ttl:             time.Minute,
+					cacheDir:        tmpdir,
+					inflight:        tt.inflight,
+					inflightTimeout: 100 * time.Millisecond,
+				},
+				clock: fixedClock(now),
+			}
+			stdout1 := new(bytes.Buffer)
+			cachecmd.stdout = stdout1
+			if _, err := cachecmd.Run(context.TODO()); err != nil {
+				t.Fatal(err)
+			}
+
+			// Simulate running process with expired cache.
+			lock, err := tryLock(cachecmd.cacheFilePath()+".LOCK", lockAuto, defaultFileMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lock.unlock()
+			cachecmd.clock = fixedClock(now.Add(time.Hour))
+
+			stdout2 := new(bytes.Buffer)
+			cachecmd.stdout = stdout2
+			if _, err := cachecmd.Run(context.TODO()); err != nil {
+				t.Fatal(err)
+			}
+			if got := stdout1.String() == stdout2.String(); got != tt.wantCache {
+				t.Errorf("got result from cache=%v, want cache=%v", got, tt.wantCache)
+			}
+		})
+	}
+}
+
+func TestCacheCmd_Run_minRuntime(t *testing.T) {
+	tests := []struct {
+		name      string
+		cmdArgs   []string
+		wantCache bool
+	}{
+		{name: "fast", cmdArgs: []string{"-c", "date +%N"}, wantCache: false},
+		{name: "slow", cmdArgs: []string{"-c", "date +%N; sleep 0.2"}, wantCache: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+			defer os.RemoveAll(tmpdir)
+			cachecmd := CacheCmd{
+				stdout:  ioutil.Discard,
+				stderr:  ioutil.Discard,
+				cmdName: "sh",
+				cmdArgs: tt.cmdArgs,
+				opt:     option{ttl: time.Minute, cacheDir: tmpdir, minRuntime: 100 * time.Millisecond},
+			}
+			if _, err := cachecmd.Run(context.TODO()); err != nil {
+				t.Fatal(err)
+			}
+			if got := fileexists(cachecmd.cacheFilePath() + ".ENTRY"); got != tt.wantCache {
+				t.Errorf("got cache=%v, want cache=%v", got, tt.wantCache)
+			}
+			if !tt.wantCache {
+				return
+			}
+			meta, err := readMeta(cachecmd.cacheFilePath() + ".ENTRY")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.Runtime < 100*time.Millisecond {
+				t.Errorf("got runtime %v in metadata, want >= 100ms", meta.Runtime)
+			}
+		})
+	}
+}
+
+func TestCacheCmd_Run_minInterval(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	now := time.Now()
+	cachecmd := CacheCmd{
+		stderr:  ioutil.Discard,
+		cmdName: "date",
+		cmdArgs: []string{`+%N`},
+		opt:     option{ttl: 0, cacheDir: tmpdir, minInterval: time.Minute},
+		clock:   fixedClock(now),
+	}
+	run := func() string {
+		stdout := new(bytes.Buffer)
+		cachecmd.stdout = stdout
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		return stdout.String()
+	}
+	first := run()
+	if got := run(); got != first {
+		t.Errorf("got %q within -min-interval, want cached %q", got, first)
+	}
+	cachecmd.opt.refresh = true
+	if got := run(); got != first {
+		t.Errorf("got %q with -refresh within -min-interval, want cached %q", got, first)
+	}
+	cachecmd.clock = fixedClock(now.Add(2 * time.Minute))
+	if got := run(); got == first {
+		t.Errorf("got cached %q after -min-interval, want fresh output", got)
+	}
+}
+
+func TestCacheCmd_Run_onlyCached(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	now := time.Now()
+	cachecmd := CacheCmd{
+		stderr:  ioutil.Discard,
+		cmdName: "date",
+		cmdArgs: []string{`+%N`},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir, onlyCached: true},
+		clock:   fixedClock(now),
+	}
+
+	stdout1 := new(bytes.Buffer)
+	cachecmd.stdout = stdout1
+	if code, err := cachecmd.Run(context.TODO()); code != exitCodeNoCache || err != errNoCache {
+		t.Fatalf("got (%d, %v) without cache, want (%d, %v)", code, err, exitCodeNoCache, errNoCache)
+	}
+	if stdout1.Len() > 0 {
+		t.Errorf("got output %q, want command not to run", stdout1.String())
+	}
+
+	cachecmd.opt.onlyCached = false
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	cachecmd.opt.onlyCached = true
+	cachecmd.clock = fixedClock(now.Add(time.Hour))
+	stdout2 := new(bytes.Buffer)
+	cachecmd.stdout = stdout2
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if stdout1.String() != stdout2.String() {
+		t.Error("got different result, want expired cache")
+	}
+}
+
+func TestCacheCmd_Run_requireFresh(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	now := time.Now()
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "date",
+		cmdArgs: []string{`+%N`},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir},
+		clock:   fixedClock(now),
+	}
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	cachecmd.opt.requireFresh = true
+	if code, err := cachecmd.Run(context.TODO()); code != 0 || err != nil {
+		t.Errorf("got (%d, %v) with fresh cache, want (0, nil)", code, err)
+	}
+	cachecmd.clock = fixedClock(now.Add(time.Hour))
+	if code, err := cachecmd.Run(context.TODO()); code != exitCodeNoCache || err != errNoFreshCache {
+		t.Errorf("got (%d, %v) with expired cache, want (%d, %v)", code, err, exitCodeNoCache, errNoFreshCache)
+	}
+}
+
 func TestCacheCmd_Run_exit_non_zero(t *testing.T) {
 	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
 	defer os.RemoveAll(tmpdir)
@@ -201,7 +447,7 @@ func TestCacheCmd_Run_async(t *testing.T) {
 				cmdArgs: args,
 				opt:     opt,
 
-				currentTime:  now,
+				clock:        fixedClock(now),
 				cachecmdExec: bin,
 			}
 
@@ -211,7 +457,7 @@ func TestCacheCmd_Run_async(t *testing.T) {
 
 			stdout2 := new(bytes.Buffer)
 			cachecmd.stdout = stdout2
-			cachecmd.currentTime = now.Add(time.Second)
+			cachecmd.clock = fixedClock(now.Add(time.Second))
 
 			if _, err := cachecmd.Run(context.TODO()); err != nil {
 				t.Fatalf("unexpected error w/ second run: %v", err)
@@ -221,7 +467,7 @@ func TestCacheCmd_Run_async(t *testing.T) {
 				t.Error("got different result, want cached result from second run")
 			}
 
-			cachecmd.currentTime = now.Add(time.Second)
+			cachecmd.clock = fixedClock(now.Add(time.Second))
 			if err := tryToGetNewResult(cachecmd, 50, 10*time.Millisecond, stdout1.String()); err != nil {
 				t.Fatalf("unexpected error w/ third run: %v", err)
 			}
@@ -229,6 +475,31 @@ func TestCacheCmd_Run_async(t *testing.T) {
 	}
 }
 
+func TestCacheCmd_Run_async_locked(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "date",
+		cmdArgs: []string{`+%N`},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir, async: true},
+		// Fail if it spawns update command.
+		cachecmdExec: "cachecmd_not_found",
+	}
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := tryLock(cachecmd.cacheFilePath()+".LOCK", lockAuto, defaultFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.unlock()
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Errorf("got error %v, want no update command while locked", err)
+	}
+}
+
 func tryToGetNewResult(cachecmd CacheCmd, n int, interval time.Duration, cache string) error {
 	if n < 1 {
 		return errors.New("got cached result")
@@ -259,3 +530,598 @@ func prepareBinary(t *testing.T) (bin string, cleanup func(), err error) {
 	err = exec.Command("go", "build", "-o", bin, pkg).Run()
 	return bin, cleanup, err
 }
+
+func TestCacheCmd_cacheFileName(t *testing.T) {
+	tests := []struct {
+		a, b CacheCmd
+	}{
+		{
+			a: CacheCmd{cmdName: "echo", cmdArgs: []string{"a b"}},
+			b: CacheCmd{cmdName: "echo", cmdArgs: []string{"a", "b"}},
+		},
+		{
+			a: CacheCmd{cmdName: "echo a"},
+			b: CacheCmd{cmdName: "echo", cmdArgs: []string{"a"}},
+		},
+		{
+			a: CacheCmd{cmdName: "echo", opt: option{cacheKey: "a"}},
+			b: CacheCmd{cmdName: "echo", cmdArgs: []string{"a"}},
+		},
+	}
+	for _, tt := range tests {
+		if tt.a.cacheFileName() == tt.b.cacheFileName() {
+			t.Errorf("got the same cache file name for %q and %q",
+				append([]string{tt.a.cmdName}, tt.a.cmdArgs...),
+				append([]string{tt.b.cmdName}, tt.b.cmdArgs...))
+		}
+	}
+}
+
+func TestCacheCmd_Run_changeHash(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	for i, hash := range []string{"md5", "sha256", "md5"} {
+		stdout := new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  stdout,
+			stderr:  ioutil.Discard,
+			cmdName: "date",
+			cmdArgs: []string{"+%N"},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir, hash: hash},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && cachecmd.status != statusHit {
+			t.Errorf("#%d: -hash=%s: got status %q, want %q", i, hash, cachecmd.status, statusHit)
+		}
+	}
+	if names, _ := filepath.Glob(filepath.Join(tmpdir, "*.ENTRY")); len(names) != 1 {
+		t.Errorf("got entries %q, want one entry", names)
+	}
+}
+
+func TestCacheCmd_Run_changeHash_hmac(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	var first string
+	for i, hash := range []string{"md5", "sha256"} {
+		stdout := new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  stdout,
+			stderr:  ioutil.Discard,
+			cmdName: "date",
+			cmdArgs: []string{"+%N"},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir, hash: hash, namespace: "ns", hmacKey: []byte("secret")},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = stdout.String()
+			continue
+		}
+		// The entry is signed again with the new name instead of broken.
+		if cachecmd.status != statusHit || stdout.String() != first {
+			t.Errorf("got status %q and %q, want %q and %q", cachecmd.status, stdout.String(), statusHit, first)
+		}
+	}
+}
+
+func TestCacheCmd_Run_interleaved(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "sh",
+		cmdArgs: []string{"-c", "echo out1; sleep 0.1; echo err1 >&2; sleep 0.1; echo out2"},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir},
+	}
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	var combined bytes.Buffer
+	cachecmd.stdout = &orderWriter{prefix: "1:", w: &combined}
+	cachecmd.stderr = &orderWriter{prefix: "2:", w: &combined}
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := combined.String(), "1:out1\n2:err1\n1:out2\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCacheCmd_Run_combine(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	for i := 0; i < 2; i++ {
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  stdout,
+			stderr:  stderr,
+			cmdName: "sh",
+			cmdArgs: []string{"-c", "echo out1; echo err1 >&2; echo out2"},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir, combine: true},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := stdout.String(), "out1\nerr1\nout2\n"; got != want {
+			t.Errorf("#%d: stdout: got %q, want %q", i, got, want)
+		}
+		if stderr.Len() != 0 {
+			t.Errorf("#%d: stderr: got %q, want empty", i, stderr.String())
+		}
+	}
+}
+
+func TestCacheCmd_Run_noStderr(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	for i, wantStderr := range []string{"err\n", ""} {
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  stdout,
+			stderr:  stderr,
+			cmdName: "sh",
+			cmdArgs: []string{"-c", "echo out; echo err >&2"},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir, noStderr: true},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		if got := stdout.String(); got != "out\n" {
+			t.Errorf("#%d: stdout: got %q, want %q", i, got, "out\n")
+		}
+		if got := stderr.String(); got != wantStderr {
+			t.Errorf("#%d: stderr: got %q, want %q", i, got, wantStderr)
+		}
+	}
+}
+
+func TestCacheCmd_Run_changed(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	state := filepath.Join(tmpdir, "state")
+	tests := []struct {
+		state string
+		want  int
+	}{
+		{state: "a", want: 1},
+		{state: "a", want: 0},
+		{state: "b", want: 1},
+	}
+	for i, tt := range tests {
+		if err := ioutil.WriteFile(state, []byte(tt.state), 0600); err != nil {
+			t.Fatal(err)
+		}
+		stdout := new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  stdout,
+			stderr:  ioutil.Discard,
+			cmdName: "cat",
+			cmdArgs: []string{state},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir, changed: true},
+		}
+		code, err := cachecmd.Run(context.TODO())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.want {
+			t.Errorf("#%d: got exit code %d, want %d", i, code, tt.want)
+		}
+		if stdout.String() != tt.state {
+			t.Errorf("#%d: got %q, want fresh output %q", i, stdout.String(), tt.state)
+		}
+	}
+}
+
+func TestCacheCmd_Run_largeStderr(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cachecmd := CacheCmd{
+		stdout:  stdout,
+		stderr:  stderr,
+		cmdName: "sh",
+		// Write more than pipe buffer to stderr before stdout.
+		cmdArgs: []string{"-c", "i=0; while [ $i -lt 20000 ]; do echo 0123456789; i=$((i+1)); done >&2; echo done"},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir},
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := cachecmd.Run(context.TODO())
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("deadlock")
+	}
+	if stdout.String() != "done\n" || stderr.Len() != 220000 {
+		t.Errorf("got stdout %q and %d bytes stderr, want %q and 220000 bytes", stdout.String(), stderr.Len(), "done\n")
+	}
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) { return 0, errors.New("write error") }
+
+func TestCacheCmd_runCmd_cacheError(t *testing.T) {
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "sh",
+		cmdArgs: []string{"-c", "echo out; echo err >&2"},
+	}
+	err := cachecmd.runCmd(context.TODO(), ioutil.Discard, errWriter{})
+	if err == nil || !strings.Contains(err.Error(), "failed to copy stderr to cache") {
+		t.Errorf("got %v, want error of copying stderr", err)
+	}
+}
+
+func TestCacheCmd_slug(t *testing.T) {
+	tests := []struct {
+		cmdName string
+		cmdArgs []string
+		want    string
+	}{
+		{cmdName: "kubectl", cmdArgs: []string{"get", "pods"}, want: "kubectl_get_pods"},
+		{cmdName: "/usr/bin/date", cmdArgs: []string{"+%N"}, want: "date_N"},
+		{cmdName: "sh", cmdArgs: []string{"-c", "date; sleep 3s"}, want: "sh_-c_date_sleep_3s"},
+		{cmdName: "echo", cmdArgs: []string{strings.Repeat("a", 100)}, want: "echo_" + strings.Repeat("a", 43)},
+	}
+	for _, tt := range tests {
+		c := CacheCmd{cmdName: tt.cmdName, cmdArgs: tt.cmdArgs}
+		if got := c.slug(); got != tt.want {
+			t.Errorf("slug of %q %q = %q, want %q", tt.cmdName, tt.cmdArgs, got, tt.want)
+		}
+	}
+}
+
+func TestCacheCmd_shouldRefreshInBackground(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	base := filepath.Join(tmpdir, "cache")
+	if err := ioutil.WriteFile(base+".ENTRY", nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(base + ".ENTRY")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opt  option
+		age  time.Duration
+		want bool
+	}{
+		{opt: option{ttl: 10 * time.Minute}, age: 9 * time.Minute, want: false},
+		{opt: option{ttl: 10 * time.Minute, async: true}, age: time.Minute, want: true},
+		{opt: option{ttl: 10 * time.Minute, refreshAhead: 0.2}, age: 7 * time.Minute, want: false},
+		{opt: option{ttl: 10 * time.Minute, refreshAhead: 0.2}, age: 9 * time.Minute, want: true},
+	}
+	for _, tt := range tests {
+		c := CacheCmd{opt: tt.opt, clock: fixedClock(stat.ModTime().Add(tt.age))}
+		if got := c.shouldRefreshInBackground(base); got != tt.want {
+			t.Errorf("shouldRefreshInBackground() with %+v and age %v = %v, want %v",
+				tt.opt, tt.age, got, tt.want)
+		}
+	}
+}
+
+func TestPercentValue(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{in: "20%", want: 0.2},
+		{in: "0.5", want: 0.5},
+		{in: "100%", want: 1},
+	}
+	for _, tt := range tests {
+		var p percentValue
+		if err := p.Set(tt.in); err != nil {
+			t.Errorf("Set(%q) got error: %v", tt.in, err)
+			continue
+		}
+		if float64(p) != tt.want {
+			t.Errorf("Set(%q) = %v, want %v", tt.in, float64(p), tt.want)
+		}
+	}
+	for _, in := range []string{"120%", "-1", "x"} {
+		var p percentValue
+		if err := p.Set(in); err == nil {
+			t.Errorf("Set(%q) got nil error", in)
+		}
+	}
+}
+
+func TestSizeValue(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{in: "100", want: 100},
+		{in: "10K", want: 10 << 10},
+		{in: "10MB", want: 10 << 20},
+		{in: "1g", want: 1 << 30},
+	}
+	for _, tt := range tests {
+		var v sizeValue
+		if err := v.Set(tt.in); err != nil {
+			t.Errorf("Set(%q) got error: %v", tt.in, err)
+			continue
+		}
+		if int64(v) != tt.want {
+			t.Errorf("Set(%q) = %v, want %v", tt.in, int64(v), tt.want)
+		}
+	}
+	for _, in := range []string{"-1", "x", "1T"} {
+		var v sizeValue
+		if err := v.Set(in); err == nil {
+			t.Errorf("Set(%q) got nil error", in)
+		}
+	}
+}
+
+func TestCacheCmd_Run_maxOutputSize(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	count := filepath.Join(tmpdir, "count")
+	for i := 0; i < 2; i++ {
+		stdout := new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  stdout,
+			stderr:  ioutil.Discard,
+			cmdName: "sh",
+			cmdArgs: []string{"-c", "echo x >> " + count + "; seq 1000"},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir, maxOutputSize: 100},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(stdout.String(), "\n"); got != 1000 {
+			t.Errorf("#%d: got %d lines, want 1000", i, got)
+		}
+		base := cachecmd.cacheFilePath()
+		if fileexists(base + ".ENTRY") {
+			t.Errorf("#%d: too large output is cached", i)
+		}
+		if !fileexists(base + ".UNCACHEABLE") {
+			t.Errorf("#%d: entry is not marked as uncacheable", i)
+		}
+	}
+	b, _ := ioutil.ReadFile(count)
+	if got := strings.Count(string(b), "x"); got != 2 {
+		t.Errorf("command run %d times, want 2", got)
+	}
+}
+
+func TestTTLValue(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{in: "10m", want: 10 * time.Minute},
+		{in: "1d", want: 24 * time.Hour},
+		{in: "2w", want: 14 * 24 * time.Hour},
+		{in: "never", want: ttlNever},
+		{in: "inf", want: ttlNever},
+		{in: "0", want: 0},
+	}
+	for _, tt := range tests {
+		var v ttlValue
+		if err := v.Set(tt.in); err != nil {
+			t.Errorf("Set(%q) got error: %v", tt.in, err)
+			continue
+		}
+		if time.Duration(v) != tt.want {
+			t.Errorf("Set(%q) = %v, want %v", tt.in, time.Duration(v), tt.want)
+		}
+		var v2 ttlValue
+		if err := v2.Set(v.String()); err != nil || v2 != v {
+			t.Errorf("Set(%q).String() = %q, which does not round-trip", tt.in, v.String())
+		}
+	}
+	for _, in := range []string{"1.5d", "-1d", "x", "1000000w"} {
+		var v ttlValue
+		if err := v.Set(in); err == nil {
+			t.Errorf("Set(%q) got nil error", in)
+		}
+	}
+}
+
+func TestCacheCmd_expired(t *testing.T) {
+	sched, _ := parseExpireAt("06:00")
+	now := time.Date(2018, 5, 1, 7, 0, 30, 0, time.Local)
+	c := CacheCmd{opt: option{expire: sched}, clock: fixedClock(now)}
+	if !c.expired(2 * time.Hour) {
+		t.Error("cache created at 05:00 is not expired at 07:00")
+	}
+	if c.expired(30 * time.Minute) {
+		t.Error("cache created at 06:30 is expired at 07:00")
+	}
+}
+
+func TestCacheCmd_Run_showAge(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	for i, want := range []string{"", "cachecmd: cached 0s ago, expires in 10m0s\n"} {
+		stderr := new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  ioutil.Discard,
+			stderr:  stderr,
+			cmdName: "true",
+			opt:     option{ttl: 10 * time.Minute, cacheDir: tmpdir, showAge: true},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		if got := stderr.String(); got != want {
+			t.Errorf("#%d: got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestCacheCmd_expiryString(t *testing.T) {
+	sched, _ := parseExpireAt("06:00")
+	now := time.Date(2018, 5, 1, 5, 30, 30, 0, time.Local)
+	tests := []struct {
+		opt  option
+		age  time.Duration
+		want string
+	}{
+		{opt: option{ttl: time.Hour}, age: 10 * time.Minute, want: "expires in 50m0s"},
+		{opt: option{ttl: time.Hour}, age: 70 * time.Minute, want: "expired 10m0s ago"},
+		{opt: option{ttl: ttlNever}, age: time.Hour, want: "never expires"},
+		{opt: option{ttl: time.Hour, expire: sched}, age: 30 * time.Second, want: "expires in 29m30s"},
+	}
+	for _, tt := range tests {
+		c := CacheCmd{opt: tt.opt, clock: fixedClock(now)}
+		if got := c.expiryString("", tt.age); got != tt.want {
+			t.Errorf("expiryString(%v) with %+v = %q, want %q", tt.age, tt.opt, got, tt.want)
+		}
+	}
+}
+
+func TestCacheCmd_Run_status(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	tests := []struct {
+		opt  option
+		want string
+	}{
+		{opt: option{ttl: time.Minute}, want: "MISS\n"},
+		{opt: option{ttl: time.Minute}, want: "HIT\n"},
+		{opt: option{ttl: time.Nanosecond, ttlSet: true, onlyCached: true}, want: "STALE\n"},
+		{opt: option{ttl: 0}, want: "MISS\n"},
+	}
+	for i, tt := range tests {
+		status := new(bytes.Buffer)
+		tt.opt.cacheDir = tmpdir
+		cachecmd := CacheCmd{
+			stdout:    ioutil.Discard,
+			stderr:    ioutil.Discard,
+			cmdName:   "true",
+			opt:       tt.opt,
+			statusOut: status,
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		if got := status.String(); got != tt.want {
+			t.Errorf("#%d: got %q, want %q", i, got, tt.want)
+		}
+	}
+}
+
+func TestCacheDir(t *testing.T) {
+	for _, env := range []string{"XDG_CACHE_HOME", "HOME"} {
+		defer os.Setenv(env, os.Getenv(env))
+	}
+	os.Setenv("XDG_CACHE_HOME", "/tmp/xdg")
+	if got, want := cacheDir(), filepath.Join("/tmp/xdg", "cachecmd"); got != want {
+		t.Errorf("with XDG_CACHE_HOME: got %q, want %q", got, want)
+	}
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" || runtime.GOOS == "plan9" {
+		return
+	}
+	os.Unsetenv("XDG_CACHE_HOME")
+	os.Unsetenv("HOME")
+	if got := cacheDir(); !strings.HasPrefix(got, os.TempDir()) {
+		t.Errorf("without HOME: got %q, want a directory in %q", got, os.TempDir())
+	}
+}
+
+func TestOptionCacheDir_volatile(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+
+	os.Setenv("XDG_RUNTIME_DIR", tmpdir)
+	opt := option{cacheDir: "cache", namespace: "proj1", volatile: true}
+	want := filepath.Join(tmpdir, "cachecmd", "proj1")
+	if got, err := optionCacheDir(opt); err != nil || got != want {
+		t.Errorf("optionCacheDir() = %q, %v, want %q", got, err, want)
+	}
+	os.Unsetenv("XDG_RUNTIME_DIR")
+	if got, err := optionCacheDir(opt); err == nil {
+		t.Errorf("optionCacheDir() without XDG_RUNTIME_DIR = %q, want error", got)
+	}
+	opt.volatile = false
+	if got, err := optionCacheDir(opt); err != nil || got != filepath.Join("cache", "proj1") {
+		t.Errorf("optionCacheDir() without -volatile = %q, %v", got, err)
+	}
+}
+
+func TestShellArgs(t *testing.T) {
+	defer os.Setenv("SHELL", os.Getenv("SHELL"))
+	os.Setenv("SHELL", "/bin/zsh")
+	tests := []struct {
+		shell string
+		want  []string
+	}{
+		{shell: "", want: []string{"/bin/zsh", "-c", "ls | wc"}},
+		{shell: "bash", want: []string{"bash", "-c", "ls | wc"}},
+		{shell: "cmd.exe", want: []string{"cmd.exe", "/c", "ls | wc"}},
+		{shell: "pwsh", want: []string{"pwsh", "-Command", "ls | wc"}},
+	}
+	for _, tt := range tests {
+		got := shellArgs(tt.shell, "ls | wc")
+		if strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") {
+			t.Errorf("shellArgs(%q) = %q, want %q", tt.shell, got, tt.want)
+		}
+	}
+}
+
+func TestRun_shellString(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	opt := option{ttl: time.Minute, cacheDir: tmpdir, noStdin: true, shellString: "echo a | tr a b", shell: "sh"}
+	stdout := new(bytes.Buffer)
+	if _, err := run(nil, stdout, ioutil.Discard, opt, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := stdout.String(); got != "b\n" {
+		t.Errorf("got %q, want %q", got, "b\n")
+	}
+	if _, err := run(nil, stdout, ioutil.Discard, opt, []string{"ls"}); err == nil {
+		t.Error("-c with command arguments got nil error")
+	}
+}
+
+func TestCommandArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{args: []string{"-ttl=1m", "uname", "-a"}, want: []string{"uname", "-a"}},
+		{args: []string{"-ttl=1m", "--", "ls", "-l"}, want: []string{"ls", "-l"}},
+		{args: []string{"-ttl=1m", "--", "mycmd", "-ttl=weird", "-async"}, want: []string{"mycmd", "-ttl=weird", "-async"}},
+		{args: []string{"-ttl=1m", "--", "clean"}, want: []string{"clean"}},
+		{args: []string{"-ttl=1m", "clean"}, wantErr: true},
+		{args: []string{"-ttl=1m", "ls", "-l"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("cachecmd", flag.ContinueOnError)
+		registerFlags(fs, &option{})
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		got, err := commandArgs(tt.args, fs.Args())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("commandArgs(%q) got error %v, want error %v", tt.args, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("commandArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
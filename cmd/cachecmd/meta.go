@@ -0,0 +1,75 @@
+package main
+
+import (
+	"time"
+)
+
+// entryMeta is metadata of a cache entry. It's stored as JSON in .ENTRY file.
+type entryMeta struct {
+	// ExitCode is exit code of the command. It's always written, including 0
+	// of successful runs.
+	ExitCode int `json:"exit_code"`
+	// Signal is number of the signal which killed the command. ExitCode is
+	// 128+Signal then as shells do.
+	Signal int `json:"signal,omitempty"`
+	// StdoutHash is SHA-256 hash of stdout of the command.
+	StdoutHash string `json:"stdout_hash,omitempty"`
+	// NormalizedHash is SHA-256 hash of stdout normalized by "normalize" rules
+	// of the config file.
+	NormalizedHash string `json:"normalized_hash,omitempty"`
+	// AdaptiveTTL is TTL of the entry with -adaptive-ttl.
+	AdaptiveTTL time.Duration `json:"adaptive_ttl,omitempty"`
+	// CachedAt is when the entry is written in Unix time in nanoseconds.
+	CachedAt int64 `json:"cached_at,omitempty"`
+	// Command is the command and its arguments.
+	Command []string `json:"command,omitempty"`
+	// Runtime is wall-clock duration of the command. UserTime and SystemTime
+	// are CPU time of the command.
+	Runtime    time.Duration `json:"runtime,omitempty"`
+	UserTime   time.Duration `json:"user_time,omitempty"`
+	SystemTime time.Duration `json:"system_time,omitempty"`
+	// TTL is TTL of the entry when it's written. TTLFromCommand is whether
+	// it's set by the command via CACHECMD_CONTROL.
+	TTL            time.Duration `json:"ttl,omitempty"`
+	TTLFromCommand bool          `json:"ttl_from_command,omitempty"`
+	// TimedOut is whether the command was killed by -timeout.
+	TimedOut bool `json:"timed_out,omitempty"`
+	// Compression is codec of cached output. Empty means no compression.
+	Compression string `json:"compression,omitempty"`
+}
+
+// nextMeta returns meta of the new result of the command with values derived
+// from metadata of the previous cache entry.
+func (c *CacheCmd) nextMeta(prev, meta entryMeta) entryMeta {
+	if c.opt.adaptiveTTL {
+		meta.AdaptiveTTL = c.nextAdaptiveTTL(prev, meta)
+	}
+	return meta
+}
+
+// nextAdaptiveTTL returns TTL which is doubled if output is unchanged and
+// halved if output is changed, within -min-ttl and -max-ttl.
+func (c *CacheCmd) nextAdaptiveTTL(prev, meta entryMeta) time.Duration {
+	ttl := prev.AdaptiveTTL
+	if ttl <= 0 {
+		ttl = c.opt.ttl
+	}
+	if prev.StdoutHash != "" {
+		if sameOutput(prev, meta) {
+			if ttl < ttlNever/2 {
+				ttl *= 2
+			} else {
+				ttl = ttlNever
+			}
+		} else {
+			ttl /= 2
+		}
+	}
+	if ttl < c.opt.minTTL {
+		ttl = c.opt.minTTL
+	}
+	if ttl > c.opt.maxTTL {
+		ttl = c.opt.maxTTL
+	}
+	return ttl
+}
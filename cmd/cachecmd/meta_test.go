@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_nextAdaptiveTTL(t *testing.T) {
+	c := CacheCmd{opt: option{ttl: 10 * time.Minute, minTTL: 5 * time.Minute, maxTTL: 30 * time.Minute}}
+	tests := []struct {
+		name string
+		prev entryMeta
+		hash string
+		want time.Duration
+	}{
+		{name: "first run", prev: entryMeta{}, hash: "a", want: 10 * time.Minute},
+		{name: "unchanged", prev: entryMeta{StdoutHash: "a", AdaptiveTTL: 10 * time.Minute}, hash: "a", want: 20 * time.Minute},
+		{name: "changed", prev: entryMeta{StdoutHash: "a", AdaptiveTTL: 20 * time.Minute}, hash: "b", want: 10 * time.Minute},
+		{name: "max", prev: entryMeta{StdoutHash: "a", AdaptiveTTL: 20 * time.Minute}, hash: "a", want: 30 * time.Minute},
+		{name: "min", prev: entryMeta{StdoutHash: "a", AdaptiveTTL: 6 * time.Minute}, hash: "b", want: 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := c.nextAdaptiveTTL(tt.prev, entryMeta{StdoutHash: tt.hash}); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCacheCmd_nextAdaptiveTTL_never(t *testing.T) {
+	c := CacheCmd{opt: option{ttl: ttlNever, minTTL: ttlNever / 4, maxTTL: ttlNever}}
+	prev := entryMeta{StdoutHash: "a", AdaptiveTTL: ttlNever}
+	if got := c.nextAdaptiveTTL(prev, entryMeta{StdoutHash: "a"}); got != ttlNever {
+		t.Errorf("got %v, want %v", got, ttlNever)
+	}
+}
+
+func TestCacheCmd_ttl(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	base := filepath.Join(tmpdir, "entry")
+	tests := []struct {
+		name string
+		meta entryMeta
+		opt  option
+		want time.Duration
+	}{
+		{name: "stored", meta: entryMeta{TTL: time.Hour}, opt: option{ttl: time.Minute}, want: time.Hour},
+		{name: "override", meta: entryMeta{TTL: time.Hour}, opt: option{ttl: time.Minute, ttlSet: true}, want: time.Minute},
+		{name: "command", meta: entryMeta{TTL: time.Hour, TTLFromCommand: true}, opt: option{ttl: time.Minute, ttlSet: true}, want: time.Hour},
+		{name: "adaptive", meta: entryMeta{TTL: time.Hour, AdaptiveTTL: 2 * time.Hour}, opt: option{ttl: time.Minute, adaptiveTTL: true}, want: 2 * time.Hour},
+		{name: "force", meta: entryMeta{TTL: time.Hour}, opt: option{ttl: 0, ttlSet: true}, want: 0},
+		{name: "old entry", meta: entryMeta{}, opt: option{ttl: time.Minute}, want: time.Minute},
+	}
+	for _, tt := range tests {
+		f, err := os.Create(base + ".ENTRY")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writeEntryMeta(newChecksumWriter(f, nil, ""), tt.meta)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := CacheCmd{opt: tt.opt}
+		if got := c.ttl(base); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
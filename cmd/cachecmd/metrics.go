@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// metricFamily is a metric family of OpenMetrics with samples per entry or a
+// single sample of the total.
+type metricFamily struct {
+	name string
+	help string
+	// unit is empty for metrics without unit. The name ends with the unit.
+	unit string
+	// value returns the value of the entry and whether it's known.
+	value func(e entryStats) (float64, bool)
+	// total is used instead of value for the total.
+	total func(t totalStats) float64
+}
+
+var metricFamilies = []metricFamily{
+	{name: "cachecmd_entries", help: "Number of cache entries.",
+		total: func(t totalStats) float64 { return float64(t.Entries) }},
+	{name: "cachecmd_size_bytes", help: "Total size of cache entries.", unit: "bytes",
+		total: func(t totalStats) float64 { return float64(t.Size) }},
+	{name: "cachecmd_hits", help: "Number of cache hits of the entries.",
+		total: func(t totalStats) float64 { return float64(t.Hits) }},
+	{name: "cachecmd_misses", help: "Number of cache misses of the entries.",
+		total: func(t totalStats) float64 { return float64(t.Misses) }},
+	{name: "cachecmd_hit_ratio", help: "Ratio of cache hits to all uses of the entries.",
+		total: func(t totalStats) float64 { return t.HitRate }},
+	{name: "cachecmd_saved_seconds", help: "Estimated runtime of the commands saved by cache hits.", unit: "seconds",
+		total: func(t totalStats) float64 { return t.Saved }},
+	{name: "cachecmd_entry_hits", help: "Number of cache hits of the entry.",
+		value: func(e entryStats) (float64, bool) { return float64(e.Hits), true }},
+	{name: "cachecmd_entry_misses", help: "Number of cache misses of the entry.",
+		value: func(e entryStats) (float64, bool) { return float64(e.Misses), true }},
+	{name: "cachecmd_entry_last_hit_timestamp_seconds", help: "Time of the last cache hit of the entry.", unit: "seconds",
+		value: func(e entryStats) (float64, bool) { return float64(e.LastHit), e.LastHit != 0 }},
+	{name: "cachecmd_entry_cached_timestamp_seconds", help: "Time when the entry is cached.", unit: "seconds",
+		value: func(e entryStats) (float64, bool) { return float64(e.CachedAt), true }},
+	{name: "cachecmd_entry_size_bytes", help: "Size of the entry.", unit: "bytes",
+		value: func(e entryStats) (float64, bool) { return float64(e.Size), true }},
+	{name: "cachecmd_entry_exit_code", help: "Exit code of the cached command.",
+		value: func(e entryStats) (float64, bool) { return float64(e.ExitCode), e.Error == "" }},
+	{name: "cachecmd_entry_runtime_seconds", help: "Runtime of the cached command.", unit: "seconds",
+		value: func(e entryStats) (float64, bool) { return e.Runtime, e.Error == "" }},
+}
+
+// writeStatsOpenMetrics writes the statistics in OpenMetrics text format.
+// Metrics of entries are labeled with the key (file name of the entry without
+// the extension) and the command.
+func writeStatsOpenMetrics(w io.Writer, s cacheStats) error {
+	bw := bufio.NewWriter(w)
+	for _, m := range metricFamilies {
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", m.name)
+		if m.unit != "" {
+			fmt.Fprintf(bw, "# UNIT %s %s\n", m.name, m.unit)
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, m.help)
+		if m.total != nil {
+			fmt.Fprintf(bw, "%s %s\n", m.name, formatFloat(m.total(s.Total)))
+			continue
+		}
+		for _, e := range s.Entries {
+			if v, ok := m.value(e); ok {
+				key := strings.TrimSuffix(filepath.Base(e.Path), ".ENTRY")
+				fmt.Fprintf(bw, "%s{key=\"%s\",command=\"%s\"} %s\n", m.name, escapeLabel(key), escapeLabel(e.Command), formatFloat(v))
+			}
+		}
+	}
+	fmt.Fprintln(bw, "# EOF")
+	return bw.Flush()
+}
+
+// escapeLabel escapes a label value of OpenMetrics.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
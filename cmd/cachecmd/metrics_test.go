@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteStatsOpenMetrics(t *testing.T) {
+	s := cacheStats{
+		Entries: []entryStats{
+			{Path: "/cache/v4-a.ENTRY", Command: `echo "a\b"`, CachedAt: 1500000000, Size: 10, Hits: 3, Misses: 1,
+				LastHit: 1500000100, Runtime: 0.5},
+			{Path: "/cache/v4-broken.ENTRY", Command: "v4-broken.ENTRY", Size: 6, Error: "broken"},
+		},
+		Total: totalStats{Entries: 2, Size: 16, Hits: 3, Misses: 1, HitRate: 0.75, Saved: 1.5},
+	}
+	buf := new(bytes.Buffer)
+	if err := writeStatsOpenMetrics(buf, s); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"# TYPE cachecmd_hit_ratio gauge\n",
+		"cachecmd_hit_ratio 0.75\n",
+		"# UNIT cachecmd_saved_seconds seconds\n",
+		"cachecmd_saved_seconds 1.5\n",
+		`cachecmd_entry_hits{key="v4-a",command="echo \"a\\b\""} 3` + "\n",
+		`cachecmd_entry_last_hit_timestamp_seconds{key="v4-a",command="echo \"a\\b\""} 1500000100` + "\n",
+		`cachecmd_entry_size_bytes{key="v4-broken",command="v4-broken.ENTRY"} 6` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q is not in output:\n%s", want, got)
+		}
+	}
+	for _, notWant := range []string{
+		`cachecmd_entry_last_hit_timestamp_seconds{key="v4-broken"`,
+		`cachecmd_entry_exit_code{key="v4-broken"`,
+	} {
+		if strings.Contains(got, notWant) {
+			t.Errorf("unknown value %q is in output:\n%s", notWant, got)
+		}
+	}
+	if !strings.HasSuffix(got, "\n# EOF\n") {
+		t.Errorf("output does not end with # EOF:\n%s", got)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func runMigrate(args []string) (int, error) {
+	fs := newSubFlagSet("migrate", "cachecmd migrate [flags] [command]",
+		"cachecmd migrate upgrades cache entries written by older cachecmd to the current format.\n"+
+			"Entries named by md5 without command name are upgraded only for the given command.")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	dir, err := optionCacheDir(*flagOpt)
+	if err != nil {
+		return 2, err
+	}
+	n, err := migrateDir(dir)
+	if err != nil {
+		return 1, err
+	}
+	if fs.NArg() > 0 {
+		opt, err := resolveCacheKey(*flagOpt, fs.Arg(0))
+		if err != nil {
+			return 1, err
+		}
+		c := &CacheCmd{cmdName: fs.Arg(0), cmdArgs: fs.Args()[1:], opt: opt}
+		migrated, err := c.migrateLegacyEntries()
+		if err != nil {
+			return 1, err
+		}
+		n += migrated
+	}
+	fmt.Fprintf(os.Stderr, "cachecmd: migrated %d entries\n", n)
+	return 0, nil
+}
+
+// legacyEntry is cache entry written before cacheStructureVersion 4. Output
+// is stored in .STREAM file (v3) or .STDOUT and .STDERR files (v1 and v2) with
+// optional .EXIT_CODE and .META files.
+type legacyEntry struct {
+	// base is the path without suffix.
+	base   string
+	stream bool
+}
+
+var legacySuffixes = []string{".STREAM", ".STDOUT", ".STDERR", ".EXIT_CODE", ".META"}
+
+// migrateDir migrates legacy entries in dir whose names have command slug, so
+// that the names in the current format are known without the command.
+func migrateDir(dir string) (int, error) {
+	fileinfos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, fi := range fileinfos {
+		var e legacyEntry
+		var name string
+		switch fname := fi.Name(); {
+		case strings.HasPrefix(fname, "v3-") && strings.HasSuffix(fname, ".STREAM"):
+			name = strings.TrimSuffix(strings.TrimPrefix(fname, "v3-"), ".STREAM")
+			e = legacyEntry{base: filepath.Join(dir, strings.TrimSuffix(fname, ".STREAM")), stream: true}
+		case strings.HasPrefix(fname, "v2-") && strings.HasSuffix(fname, ".STDOUT"):
+			name = strings.TrimSuffix(strings.TrimPrefix(fname, "v2-"), ".STDOUT")
+			if !strings.Contains(name, "-") {
+				// No slug: the name in the current format is unknown.
+				continue
+			}
+			e = legacyEntry{base: filepath.Join(dir, strings.TrimSuffix(fname, ".STDOUT"))}
+		default:
+			continue
+		}
+		dst := filepath.Join(dir, fmt.Sprintf("v%s-%s", cacheStructureVersion, name))
+		if err := migrateEntry(e, dst); err != nil {
+			return n, fmt.Errorf("failed to migrate %s: %v", e.base, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// migrateLegacyEntries migrates legacy entries of the command named by md5.
+func (c *CacheCmd) migrateLegacyEntries() (int, error) {
+	h := md5.New()
+	// The name of v1 entries.
+	io.WriteString(h, c.opt.cacheKey)
+	io.WriteString(h, ":")
+	io.WriteString(h, c.cmdName+" "+strings.Join(c.cmdArgs, " "))
+	bases := []string{
+		fmt.Sprintf("v1-%x", h.Sum(nil)),
+		fmt.Sprintf("v2-%x", c.keyHash(md5.New())),
+	}
+	n := 0
+	for _, name := range bases {
+		e := legacyEntry{base: filepath.Join(c.opt.cacheDir, name)}
+		if !fileexists(e.base + ".STDOUT") {
+			continue
+		}
+		if err := migrateEntry(e, c.cacheFilePath()); err != nil {
+			return n, fmt.Errorf("failed to migrate %s: %v", e.base, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// migrateEntry converts legacy entry e to entry of the given base path and
+// removes e. The modification time is kept to keep the age of cache. It keeps
+// the existing entry of the current format, which is newer than e.
+func migrateEntry(e legacyEntry, dst string) error {
+	output := e.base + ".STDOUT"
+	if e.stream {
+		output = e.base + ".STREAM"
+	}
+	stat, err := os.Stat(output)
+	if err != nil {
+		return err
+	}
+	if !fileexists(dst + ".ENTRY") {
+		if err := writeMigratedEntry(e, dst+".ENTRY"); err != nil {
+			return err
+		}
+		if err := os.Chtimes(dst+".ENTRY", stat.ModTime(), stat.ModTime()); err != nil {
+			return err
+		}
+	}
+	for _, suffix := range legacySuffixes {
+		if err := os.Remove(e.base + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeMigratedEntry(e legacyEntry, path string) error {
+	var meta entryMeta
+	if b, err := ioutil.ReadFile(e.base + ".META"); err == nil {
+		if err := json.Unmarshal(b, &meta); err != nil {
+			return fmt.Errorf("failed to parse metadata: %v", err)
+		}
+	}
+	if b, err := ioutil.ReadFile(e.base + ".EXIT_CODE"); err == nil {
+		meta.ExitCode, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+	}
+
+	var output []byte
+	if e.stream {
+		b, err := legacyStream(e.base + ".STREAM")
+		if err != nil {
+			return err
+		}
+		output = b
+		// v3 replay detected gzip data by its magic bytes.
+		if bytes.HasPrefix(output, []byte{0x1f, 0x8b}) {
+			meta.Compression = compressGzip
+		} else {
+			meta.Compression = compressNone
+		}
+	} else {
+		buf := new(bytes.Buffer)
+		stream := newStreamWriter(buf)
+		for _, s := range []struct {
+			suffix string
+			id     byte
+		}{{".STDOUT", streamStdout}, {".STDERR", streamStderr}} {
+			b, err := ioutil.ReadFile(e.base + s.suffix)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			stream.writer(s.id).Write(b)
+		}
+		output = buf.Bytes()
+	}
+
+	tmpf, err := ioutil.TempFile(filepath.Dir(path), "tmp_cachecmd_")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpf.Name())
+	// Legacy entries are not signed, so neither are migrated entries. They
+	// are rejected with -hmac-key-file.
+	sum := newChecksumWriter(tmpf, nil, "")
+	_, err = sum.Write(output)
+	if err == nil {
+		err = writeEntryMeta(sum, meta)
+	}
+	if errClose := tmpf.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write cache: %v", err)
+	}
+	return os.Rename(tmpf.Name(), path)
+}
+
+// legacyStream reads output stream of v3 .STREAM file, which may have the
+// checksum trailer.
+func legacyStream(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if content, err := verifyChecksum(f, nil, ""); err == nil {
+		return ioutil.ReadAll(content)
+	}
+	return ioutil.ReadAll(f)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrate(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	newCacheCmd := func(stdout, stderr io.Writer, args ...string) *CacheCmd {
+		return &CacheCmd{
+			stdout:  stdout,
+			stderr:  stderr,
+			cmdName: "echo",
+			cmdArgs: args,
+			opt:     option{ttl: time.Hour, cacheDir: tmpdir, hash: "sha256"},
+		}
+	}
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(tmpdir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	name := func(c *CacheCmd) string {
+		return strings.TrimPrefix(c.cacheFileName(), "v"+cacheStructureVersion+"-")
+	}
+
+	// v3 entry.
+	v3 := newCacheCmd(nil, nil, "v3")
+	buf := new(bytes.Buffer)
+	sw := newStreamWriter(buf)
+	io.WriteString(sw.writer(streamStdout), "cached v3\n")
+	io.WriteString(sw.writer(streamStderr), "err v3\n")
+	write("v3-"+name(v3)+".STREAM", buf.String())
+	write("v3-"+name(v3)+".EXIT_CODE", "12")
+
+	// v2 entry with slug.
+	v2 := newCacheCmd(nil, nil, "v2")
+	write("v2-"+name(v2)+".STDOUT", "cached v2\n")
+	write("v2-"+name(v2)+".META", `{"runtime": 1000}`)
+
+	// v1 entry named by md5.
+	v1 := newCacheCmd(nil, nil, "v1")
+	h := md5.New()
+	io.WriteString(h, ":echo v1")
+	write(fmt.Sprintf("v1-%x.STDOUT", h.Sum(nil)), "cached v1\n")
+
+	n, err := migrateDir(tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("migrateDir() migrated %d entries, want 2", n)
+	}
+	if n, err := v1.migrateLegacyEntries(); err != nil || n != 1 {
+		t.Errorf("migrateLegacyEntries() = %d, %v, want 1", n, err)
+	}
+
+	tests := []struct {
+		arg        string
+		wantStdout string
+		wantStderr string
+		wantCode   int
+	}{
+		{arg: "v3", wantStdout: "cached v3\n", wantStderr: "err v3\n", wantCode: 12},
+		{arg: "v2", wantStdout: "cached v2\n"},
+		{arg: "v1", wantStdout: "cached v1\n"},
+	}
+	for _, tt := range tests {
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		code, err := newCacheCmd(stdout, stderr, tt.arg).Run(context.TODO())
+		if code != tt.wantCode {
+			t.Errorf("%s: got exit code %d (%v), want %d", tt.arg, code, err, tt.wantCode)
+		}
+		if stdout.String() != tt.wantStdout || stderr.String() != tt.wantStderr {
+			t.Errorf("%s: got (%q, %q), want (%q, %q)", tt.arg,
+				stdout.String(), stderr.String(), tt.wantStdout, tt.wantStderr)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(tmpdir, "v[123]-*"))
+	if len(files) != 0 {
+		t.Errorf("legacy files are not removed: %v", files)
+	}
+}
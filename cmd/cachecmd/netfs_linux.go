@@ -0,0 +1,30 @@
+//go:build linux
+// +build linux
+
+package main
+
+import "syscall"
+
+// Magic numbers of network file systems in statfs(2).
+var networkFSTypes = map[uint32]bool{
+	0x6969:     true, // NFS
+	0x517b:     true, // SMB
+	0xff534d42: true, // CIFS
+	0xfe534d42: true, // SMB2
+	0x65735546: true, // FUSE (e.g. sshfs)
+	0x5346414f: true, // AFS
+	0x47504653: true, // GPFS
+	0x0bd00bd0: true, // Lustre
+	0x00c36400: true, // Ceph
+}
+
+// isNetworkFS reports whether dir is on a network file system, where flock
+// may not be shared between hosts and written data may not reach the server
+// before rename.
+func isNetworkFS(dir string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return false
+	}
+	return networkFSTypes[uint32(st.Type)]
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// isNetworkFS always returns false because detecting network file systems is
+// only supported on Linux.
+func isNetworkFS(dir string) bool {
+	return false
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// normalizeRule is a rule to normalize stdout of the command (e.g. remove
+// timestamps) only when it's compared with the previous output for -changed,
+// -on-change, -adaptive-ttl and `cachecmd diff`. Cached output is not changed.
+type normalizeRule struct {
+	// Pattern is regular expression of text to normalize.
+	Pattern string `json:"pattern"`
+	// Replace is replacement of matched text. $1 is expanded to the submatch.
+	// (default: empty)
+	Replace string `json:"replace,omitempty"`
+}
+
+// compileNormalizeRules returns redactor which applies normalize rules line by
+// line.
+func compileNormalizeRules(rules []normalizeRule) (redactor, error) {
+	var r redactor
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid normalize pattern %q: %v", rule.Pattern, err)
+		}
+		r = append(r, compiledRedactRule{re: re, replace: []byte(rule.Replace)})
+	}
+	return r, nil
+}
+
+// sameOutput reports whether the entries of prev and meta have the same stdout.
+// Normalized stdout is compared if both entries have its hash.
+func sameOutput(prev, meta entryMeta) bool {
+	if prev.NormalizedHash != "" && meta.NormalizedHash != "" {
+		return prev.NormalizedHash == meta.NormalizedHash
+	}
+	return prev.StdoutHash == meta.StdoutHash
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_Run_changedNormalize(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	state := filepath.Join(tmpdir, "state")
+	c := &CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "cat",
+		cmdArgs: []string{state},
+		opt: option{ttl: time.Minute, cacheDir: tmpdir, changed: true,
+			normalize: []normalizeRule{{Pattern: `\d{2}:\d{2}:\d{2}`, Replace: "TIME"}}},
+	}
+	tests := []struct {
+		output string
+		want   int
+	}{
+		{output: "12:00:00 ok\n", want: 1},
+		{output: "12:00:05 ok\n", want: 0},
+		{output: "12:00:10 ng\n", want: 1},
+	}
+	for _, tt := range tests {
+		ioutil.WriteFile(state, []byte(tt.output), 0600)
+		code, err := c.Run(context.TODO())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.want {
+			t.Errorf("%q: got exit code %d, want %d", tt.output, code, tt.want)
+		}
+	}
+
+	ioutil.WriteFile(state, []byte("12:01:00 ng\n"), 0600)
+	if changed, err := c.diff(context.TODO(), ioutil.Discard); err != nil || changed {
+		t.Errorf("diff() = %v, %v, want unchanged after normalization", changed, err)
+	}
+}
+
+func TestSameOutput(t *testing.T) {
+	tests := []struct {
+		prev, meta entryMeta
+		want       bool
+	}{
+		{prev: entryMeta{StdoutHash: "a"}, meta: entryMeta{StdoutHash: "a"}, want: true},
+		{prev: entryMeta{StdoutHash: "a"}, meta: entryMeta{StdoutHash: "b"}, want: false},
+		{prev: entryMeta{StdoutHash: "a", NormalizedHash: "n"}, meta: entryMeta{StdoutHash: "b", NormalizedHash: "n"}, want: true},
+		// The previous entry is written without normalize rules.
+		{prev: entryMeta{StdoutHash: "a"}, meta: entryMeta{StdoutHash: "b", NormalizedHash: "n"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := sameOutput(tt.prev, tt.meta); got != tt.want {
+			t.Errorf("sameOutput(%+v, %+v) = %v, want %v", tt.prev, tt.meta, got, tt.want)
+		}
+	}
+}
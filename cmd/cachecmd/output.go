@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Output formats of -output.
+const (
+	outputRaw  = "raw"
+	outputJSON = "json"
+)
+
+func validOutput(output string) error {
+	switch output {
+	case "", outputRaw, outputJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid -output: %q", output)
+}
+
+// jsonOutput is the result of the command printed with -output=json. Age and
+// Duration are in seconds. Duration is runtime of the cached command if
+// Cached is true.
+type jsonOutput struct {
+	Stdout   string  `json:"stdout"`
+	Stderr   string  `json:"stderr"`
+	ExitCode int     `json:"exit_code"`
+	Cached   bool    `json:"cached"`
+	Age      float64 `json:"age"`
+	Duration float64 `json:"duration"`
+}
+
+// runJSON runs Run with buffered stdout and stderr and writes the result to
+// stdout as JSON. Output which is not valid UTF-8 is replaced with U+FFFD.
+func (c *CacheCmd) runJSON(ctx context.Context) (int, error) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	out := c.stdout
+	c.stdout, c.stderr = stdout, stderr
+	code, err := c.Run(ctx)
+	if err != nil {
+		return code, err
+	}
+	cached := c.status == statusHit || c.status == statusStale
+	result := jsonOutput{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		ExitCode: code,
+		Cached:   cached,
+		Duration: c.runtime.Seconds(),
+	}
+	if cached {
+		result.Age = c.age.Seconds()
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return 1, err
+	}
+	if _, err := fmt.Fprintf(out, "%s\n", b); err != nil {
+		return 1, fmt.Errorf("failed to write output: %v", err)
+	}
+	return code, nil
+}
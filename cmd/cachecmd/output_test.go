@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_runJSON(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	for i, wantCached := range []bool{false, true} {
+		stdout := new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  stdout,
+			stderr:  ioutil.Discard,
+			cmdName: "sh",
+			cmdArgs: []string{"-c", "echo out; echo err >&2; exit 3"},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir},
+		}
+		code, err := cachecmd.runJSON(context.TODO())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != 3 {
+			t.Errorf("#%d: got exit code %d, want 3", i, code)
+		}
+		var got jsonOutput
+		if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+			t.Fatalf("#%d: %v: %q", i, err, stdout.String())
+		}
+		if got.Stdout != "out\n" || got.Stderr != "err\n" || got.ExitCode != 3 || got.Cached != wantCached {
+			t.Errorf("#%d: got %+v, want cached=%v", i, got, wantCached)
+		}
+		if !wantCached && got.Age != 0 {
+			t.Errorf("#%d: got age %v, want 0 for uncached result", i, got.Age)
+		}
+	}
+}
+
+func TestValidOutput(t *testing.T) {
+	for _, output := range []string{"", "raw", "json"} {
+		if err := validOutput(output); err != nil {
+			t.Errorf("validOutput(%q) = %v", output, err)
+		}
+	}
+	if err := validOutput("yaml"); err == nil {
+		t.Error("validOutput(yaml) got nil error")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// While the command is running, its output is written to the temp file in
+// cache directory incrementally and the .PARTIAL file next to the entry holds
+// the name of the temp file as the in-progress marker. Other cachecmd with
+// -inflight=tail follows the temp file, which becomes the .ENTRY file when the
+// command finishes. Output is not written incrementally with -compress.
+
+// tailInterval is the interval of polling the partially written entry.
+const tailInterval = 50 * time.Millisecond
+
+// errPartialAborted is returned when other cachecmd finishes the command
+// without caching its result while its output is followed.
+var errPartialAborted = errors.New("other cachecmd running the command did not cache the result")
+
+// markPartial writes the in-progress marker of the entry of the given base path
+// being written to f. It returns func to remove the marker.
+func (c *CacheCmd) markPartial(base string, f *os.File) (func(), error) {
+	if c.opt.compress != compressNone {
+		return func() {}, nil
+	}
+	if err := ioutil.WriteFile(base+".PARTIAL", []byte(filepath.Base(f.Name())), c.fileMode()); err != nil {
+		return nil, fmt.Errorf("failed to write in-progress marker: %v", err)
+	}
+	return func() { os.Remove(base + ".PARTIAL") }, nil
+}
+
+// tailPartial writes output of the entry of the given base path being written by
+// other cachecmd until the command finishes and returns its exit code. It
+// returns false if there is no entry being written.
+func (c *CacheCmd) tailPartial(base string) (int, bool, error) {
+	name, err := ioutil.ReadFile(base + ".PARTIAL")
+	if err != nil {
+		return 0, false, nil
+	}
+	f, err := os.Open(filepath.Join(filepath.Dir(base), filepath.Base(string(name))))
+	if err != nil {
+		// The command has already finished.
+		return 0, false, nil
+	}
+	defer f.Close()
+	stderr := c.stderr
+	if c.opt.noStderr {
+		stderr = ioutil.Discard
+	}
+	r := &tailReader{r: f, running: func() bool { return isLocked(base+".LOCK", c.opt.lockMode) }}
+	var header [5]byte
+	for {
+		if _, err := io.ReadFull(r, header[:1]); err != nil {
+			return 1, true, errPartialAborted
+		}
+		if header[0] == '{' {
+			// Metadata JSON follows the output stream.
+			break
+		}
+		if _, err := io.ReadFull(r, header[1:]); err != nil {
+			return 1, true, errPartialAborted
+		}
+		var w io.Writer
+		switch header[0] {
+		case streamStdout:
+			w = c.stdout
+		case streamStderr:
+			w = stderr
+		case streamTiming:
+			w = ioutil.Discard
+		default:
+			return 1, true, fmt.Errorf("broken cache: unknown stream %d", header[0])
+		}
+		if _, err := io.CopyN(w, r, int64(binary.BigEndian.Uint32(header[1:]))); err != nil {
+			return 1, true, errPartialAborted
+		}
+	}
+	for r.running() {
+		time.Sleep(tailInterval)
+	}
+	// The temp file must have been renamed to the entry.
+	tmp, err := f.Stat()
+	if err != nil {
+		return 1, true, err
+	}
+	if fi, err := os.Stat(base + ".ENTRY"); err != nil || !os.SameFile(tmp, fi) {
+		return 1, true, errPartialAborted
+	}
+	e, err := c.openEntry(base + ".ENTRY")
+	if err != nil {
+		return 1, true, err
+	}
+	defer e.Close()
+	c.signal = e.meta.Signal
+	c.runtime = e.meta.Runtime
+	return e.meta.ExitCode, true, nil
+}
+
+// tailReader reads r like `tail -f` while running reports true. It returns
+// io.EOF at the end of r after running reports false.
+type tailReader struct {
+	r       io.Reader
+	running func() bool
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	for {
+		// Check whether it's running before reading so that data written
+		// before it finishes is not missed.
+		running := t.running()
+		n, err := t.r.Read(p)
+		if n > 0 || err != io.EOF || !running {
+			return n, err
+		}
+		time.Sleep(tailInterval)
+	}
+}
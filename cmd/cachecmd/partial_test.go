@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_Run_inflightTail(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	newCacheCmd := func(stdout *bytes.Buffer) *CacheCmd {
+		return &CacheCmd{
+			stdout:  stdout,
+			stderr:  ioutil.Discard,
+			cmdName: "sh",
+			cmdArgs: []string{"-c", "echo 1; sleep 0.5; echo 2; exit 3"},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir, inflight: inflightTail},
+		}
+	}
+	stdout1 := new(bytes.Buffer)
+	writer := newCacheCmd(stdout1)
+	done := make(chan error)
+	go func() {
+		_, err := writer.Run(context.TODO())
+		done <- err
+	}()
+	marker := writer.cacheFilePath() + ".PARTIAL"
+	for !fileexists(marker) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stdout2 := new(bytes.Buffer)
+	code, err := newCacheCmd(stdout2).Run(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if code != 3 {
+		t.Errorf("exit code = %d, want 3", code)
+	}
+	if got, want := stdout2.String(), "1\n2\n"; got != want {
+		t.Errorf("followed output = %q, want %q", got, want)
+	}
+	if fileexists(marker) {
+		t.Error("in-progress marker is not removed")
+	}
+}
+
+func TestTailReader(t *testing.T) {
+	f, err := ioutil.TempFile("", "cachecmdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	var running int32 = 1
+	go func() {
+		f.WriteString("a")
+		time.Sleep(100 * time.Millisecond)
+		f.WriteString("b")
+		time.Sleep(100 * time.Millisecond)
+		atomic.StoreInt32(&running, 0)
+	}()
+	in, err := os.Open(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	b, err := ioutil.ReadAll(&tailReader{r: in, running: func() bool { return atomic.LoadInt32(&running) == 1 }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "ab"; got != want {
+		t.Errorf("read %q, want %q", got, want)
+	}
+}
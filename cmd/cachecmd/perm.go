@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Default permissions of cache files. Output of commands may contain secrets,
+// so only the user can read it unless cache is shared with -shared-dir. The
+// directories are created with dirMode of them.
+const (
+	defaultFileMode os.FileMode = 0600
+	sharedFileMode  os.FileMode = 0644
+)
+
+// fileMode returns permission of cache files.
+func (c *CacheCmd) fileMode() os.FileMode {
+	switch {
+	case c.opt.mode != 0:
+		return c.opt.mode
+	case c.opt.sharedDir != "":
+		return sharedFileMode
+	}
+	return defaultFileMode
+}
+
+// dirMode returns permission of directories of files of the given mode, which
+// can be listed by whom can read the files.
+func dirMode(mode os.FileMode) os.FileMode {
+	return mode | (mode&0444)>>2
+}
+
+// chmodFile sets permission of the cache file f, which is created by
+// ioutil.TempFile with 0600.
+func (c *CacheCmd) chmodFile(f *os.File) error {
+	if c.fileMode() == defaultFileMode {
+		return nil
+	}
+	return f.Chmod(c.fileMode())
+}
+
+// fixDirModes sets permission of the cache directory and its parent namespace
+// directory. Directories created by older cachecmd with os.ModePerm are
+// migrated so. Directories which other users own or which have the sticky bit
+// (e.g. -cache_dir=/tmp) are not changed.
+func (c *CacheCmd) fixDirModes() error {
+	top := c.opt.cacheDir
+	if c.opt.namespace != "" {
+		top = filepath.Dir(top)
+	}
+	want := dirMode(c.fileMode())
+	for dir := c.opt.cacheDir; ; dir = filepath.Dir(dir) {
+		fi, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		uid, ok := fileOwner(fi)
+		if ok && uid == os.Getuid() && fi.Mode()&os.ModeSticky == 0 && fi.Mode().Perm() != want {
+			if err := os.Chmod(dir, want); err != nil {
+				return fmt.Errorf("failed to change permission of cache directory: %v", err)
+			}
+		}
+		if dir == top || dir == filepath.Dir(dir) {
+			return nil
+		}
+	}
+}
+
+// modeValue is a flag.Value for octal file permission (e.g. 0640). The user
+// must be able to read and write the files.
+type modeValue os.FileMode
+
+func (m *modeValue) String() string {
+	if *m == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%#o", uint32(*m))
+}
+
+func (m *modeValue) Set(s string) error {
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v > 0777 || v&0600 != 0600 {
+		return fmt.Errorf("invalid mode: %q", s)
+	}
+	*m = modeValue(v)
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_Run_mode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission is not supported on Windows")
+	}
+	tests := []struct {
+		mode     os.FileMode
+		wantFile os.FileMode
+		wantDir  os.FileMode
+	}{
+		{mode: 0, wantFile: 0600, wantDir: 0700},
+		{mode: 0640, wantFile: 0640, wantDir: 0750},
+	}
+	for _, tt := range tests {
+		tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+		defer os.RemoveAll(tmpdir)
+		// Directory created by older cachecmd.
+		dir := filepath.Join(tmpdir, "cache")
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		cachecmd := CacheCmd{
+			stdout:  ioutil.Discard,
+			stderr:  ioutil.Discard,
+			cmdName: "echo",
+			cmdArgs: []string{"hello"},
+			opt:     option{ttl: time.Minute, cacheDir: filepath.Join(dir, "proj1"), namespace: "proj1", mode: tt.mode},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		for path, want := range map[string]os.FileMode{
+			dir:                                 tt.wantDir,
+			cachecmd.opt.cacheDir:               tt.wantDir,
+			cachecmd.cacheFilePath() + ".ENTRY": tt.wantFile,
+		} {
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fi.Mode().Perm(); got != want {
+				t.Errorf("-mode=%#o: %s has mode %#o, want %#o", tt.mode, path, got, want)
+			}
+		}
+	}
+}
+
+func TestTryLock_mode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission is not supported on Windows")
+	}
+	for _, mode := range testLockModes() {
+		tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+		defer os.RemoveAll(tmpdir)
+		path := filepath.Join(tmpdir, "a.LOCK")
+		lock, err := tryLock(path, mode, 0640)
+		if err != nil || lock == nil {
+			t.Fatalf("tryLock() = %v, %v, want lock", lock, err)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fi.Mode().Perm(); got != 0640 {
+			t.Errorf("-lock-mode=%s: lock file has mode %#o, want 0640", mode, got)
+		}
+		lock.unlock()
+	}
+}
+
+func TestModeValue(t *testing.T) {
+	var m modeValue
+	if err := m.Set("0640"); err != nil || m != 0640 {
+		t.Errorf("Set(0640) = %v, got %#o", err, m)
+	}
+	for _, s := range []string{"0400", "1777", "rw", "0"} {
+		if err := m.Set(s); err == nil {
+			t.Errorf("Set(%q) = nil, want error", s)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// cachePolicy decides which commands are cached by regular expressions of
+// command lines. Commands which are not cached just run.
+type cachePolicy struct {
+	// Allow is patterns of commands to cache. All commands are allowed if
+	// it's empty.
+	Allow []string `json:"allow,omitempty"`
+	// Deny is patterns of commands not to cache (e.g. "password", "^sudo ").
+	Deny []string `json:"deny,omitempty"`
+}
+
+type compiledPolicy struct {
+	allow, deny []*regexp.Regexp
+}
+
+func compilePolicy(p cachePolicy) (*compiledPolicy, error) {
+	compile := func(patterns []string) ([]*regexp.Regexp, error) {
+		var res []*regexp.Regexp
+		for _, pat := range patterns {
+			re, err := regexp.Compile(pat)
+			if err != nil {
+				return nil, fmt.Errorf("invalid policy pattern %q: %v", pat, err)
+			}
+			res = append(res, re)
+		}
+		return res, nil
+	}
+	allow, err := compile(p.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := compile(p.Deny)
+	if err != nil {
+		return nil, err
+	}
+	return &compiledPolicy{allow: allow, deny: deny}, nil
+}
+
+// allows reports whether the command line, which is the command name and
+// arguments joined with spaces, may be cached.
+func (p *compiledPolicy) allows(cmdline string) bool {
+	for _, re := range p.deny {
+		if re.MatchString(cmdline) {
+			return false
+		}
+	}
+	if len(p.allow) == 0 {
+		return true
+	}
+	for _, re := range p.allow {
+		if re.MatchString(cmdline) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheAllowed reports whether the policy allows caching the command.
+func (c *CacheCmd) cacheAllowed() bool {
+	p, err := compilePolicy(c.opt.policy)
+	if err != nil {
+		// Validated before running.
+		return false
+	}
+	return p.allows(strings.Join(append([]string{c.cmdName}, c.cmdArgs...), " "))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCompiledPolicy_allows(t *testing.T) {
+	tests := []struct {
+		policy  cachePolicy
+		cmdline string
+		want    bool
+	}{
+		{policy: cachePolicy{}, cmdline: "ls -l", want: true},
+		{policy: cachePolicy{Deny: []string{"password", "^sudo "}}, cmdline: "sudo ls", want: false},
+		{policy: cachePolicy{Deny: []string{"password", "^sudo "}}, cmdline: "pass show password/x", want: false},
+		{policy: cachePolicy{Deny: []string{"^sudo "}}, cmdline: "ls sudo", want: true},
+		{policy: cachePolicy{Allow: []string{"^kubectl "}}, cmdline: "kubectl get pods", want: true},
+		{policy: cachePolicy{Allow: []string{"^kubectl "}}, cmdline: "ls", want: false},
+		{policy: cachePolicy{Allow: []string{"^kubectl "}, Deny: []string{"secret"}}, cmdline: "kubectl get secret", want: false},
+	}
+	for _, tt := range tests {
+		p, err := compilePolicy(tt.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.allows(tt.cmdline); got != tt.want {
+			t.Errorf("%+v allows %q = %v, want %v", tt.policy, tt.cmdline, got, tt.want)
+		}
+	}
+	if _, err := compilePolicy(cachePolicy{Deny: []string{"("}}); err == nil {
+		t.Error("got nil error for invalid pattern")
+	}
+}
+
+func TestCacheCmd_Run_policy(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "echo",
+		cmdArgs: []string{"password"},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir, policy: cachePolicy{Deny: []string{"password"}}},
+	}
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if fileexists(cachecmd.cacheFilePath() + ".ENTRY") {
+		t.Error("denied command is cached")
+	}
+	cachecmd.opt.onlyCached = true
+	if code, err := cachecmd.Run(context.TODO()); code != exitCodeNoCache || err != errNoCache {
+		t.Errorf("got (%d, %v) with -only-cached, want (%d, %v)", code, err, exitCodeNoCache, errNoCache)
+	}
+}
@@ -0,0 +1,112 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func processExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+// detachSysProcAttr returns attributes to detach background process from the
+// session of cachecmd so that it's not killed with the session.
+func detachSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// forwardedSignals are signals which cachecmd forwards to the command.
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}
+
+// groupSysProcAttr returns attributes to run the command in its own process
+// group so that signals reach its children too.
+func groupSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// raiseSignal kills cachecmd by signal sig. It returns if the Go runtime does
+// not let cachecmd die by the signal (e.g. SIGQUIT dumps goroutines instead).
+func raiseSignal(sig int) {
+	s := syscall.Signal(sig)
+	switch s {
+	case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL:
+	default:
+		return
+	}
+	signal.Reset(s)
+	syscall.Kill(os.Getpid(), s)
+	// The signal is delivered asynchronously.
+	time.Sleep(time.Second)
+}
+
+// signalGroup sends sig to the process group led by p.
+func signalGroup(p *os.Process, sig os.Signal) error {
+	return syscall.Kill(-p.Pid, sig.(syscall.Signal))
+}
+
+// syncDir syncs the directory so that renamed files in it persist.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// fileOwner returns UID of the owner of the file.
+func fileOwner(fi os.FileInfo) (int, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(st.Uid), true
+}
+
+// rlimitSupported reports whether resource limits of the command are supported.
+const rlimitSupported = true
+
+// setRlimits sets the resource limits to this process. Limits larger than the
+// current hard limits are lowered to them.
+func setRlimits(l rlimits) error {
+	limits := []struct {
+		resource int
+		value    uint64
+	}{
+		{syscall.RLIMIT_CPU, l.cpuSeconds()},
+		{syscall.RLIMIT_AS, uint64(l.as)},
+		{syscall.RLIMIT_NOFILE, uint64(l.nofile)},
+	}
+	for _, limit := range limits {
+		if limit.value == 0 {
+			continue
+		}
+		var rlim syscall.Rlimit
+		if err := syscall.Getrlimit(limit.resource, &rlim); err != nil {
+			return err
+		}
+		if limit.value < rlim.Max {
+			rlim.Max = limit.value
+		}
+		rlim.Cur = rlim.Max
+		if err := syscall.Setrlimit(limit.resource, &rlim); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execve replaces this process with the command of the given path.
+func execve(path string, argv []string) error {
+	return syscall.Exec(path, argv, os.Environ())
+}
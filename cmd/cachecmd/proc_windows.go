@@ -0,0 +1,70 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func processExists(pid int) bool {
+	// FindProcess opens the process handle and fails if it does not exist.
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+// DETACHED_PROCESS creation flag.
+const detachedProcess = 0x00000008
+
+// detachSysProcAttr returns attributes to detach background process from the
+// console of cachecmd.
+func detachSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
+
+// forwardedSignals are signals which cachecmd forwards to the command.
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// groupSysProcAttr returns nil because Ctrl-C is delivered to all processes
+// attached to the console.
+func groupSysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+// raiseSignal does nothing because Windows has no signals to die by.
+func raiseSignal(sig int) {}
+
+// signalGroup kills p because Windows cannot send signals to processes.
+func signalGroup(p *os.Process, sig os.Signal) error {
+	return p.Kill()
+}
+
+// syncDir does nothing because directories cannot be synced on Windows.
+// Renames are journaled by NTFS.
+func syncDir(dir string) error {
+	return nil
+}
+
+// fileOwner returns false because files are not owned by UID on Windows.
+func fileOwner(fi os.FileInfo) (int, bool) {
+	return 0, false
+}
+
+// rlimitSupported reports whether resource limits of the command are supported.
+const rlimitSupported = false
+
+func setRlimits(l rlimits) error {
+	return errors.New("resource limits are not supported on Windows")
+}
+
+func execve(path string, argv []string) error {
+	return errors.New("exec is not supported on Windows")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+// defaultPromptMaxLength is the default value of -prompt-max-length.
+const defaultPromptMaxLength = 100
+
+// replayPrompt uses cache of the given base path even if it's expired with
+// -prompt, so that shell prompts never wait for the command. Cache is updated
+// in background if it's expired or not found. It exits with exitCodeNoCache
+// without output if cache is not found.
+func (c *CacheCmd) replayPrompt(base string) (int, error) {
+	if fileexists(base + ".ENTRY") {
+		if code, err := c.replayHit(base); err != errBrokenCache {
+			if err != nil || c.throttled(base) || isLocked(base+".LOCK", c.opt.lockMode) {
+				return code, err
+			}
+			return code, c.startUpdateCache()
+		}
+	}
+	if !c.throttled(base) && !isLocked(base+".LOCK", c.opt.lockMode) {
+		if err := c.startUpdateCache(); err != nil {
+			return 1, err
+		}
+	}
+	return exitCodeNoCache, nil
+}
+
+// promptWriter writes the first line of output without the newline up to max
+// characters for -prompt.
+type promptWriter struct {
+	w    io.Writer
+	max  int
+	n    int
+	done bool
+}
+
+func (p *promptWriter) Write(b []byte) (int, error) {
+	if p.done {
+		return len(b), nil
+	}
+	out := b
+	if i := bytes.IndexByte(out, '\n'); i >= 0 {
+		out = out[:i]
+		p.done = true
+	}
+	end := 0
+	for end < len(out) && (p.max <= 0 || p.n < p.max) {
+		_, size := utf8.DecodeRune(out[end:])
+		end += size
+		p.n++
+	}
+	if end < len(out) {
+		p.done = true
+	}
+	if _, err := p.w.Write(out[:end]); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestPromptWriter(t *testing.T) {
+	tests := []struct {
+		writes []string
+		max    int
+		want   string
+	}{
+		{writes: []string{"main\n"}, max: 10, want: "main"},
+		{writes: []string{"ma", "in\nsecond line\n"}, max: 10, want: "main"},
+		{writes: []string{"feature/long-branch-name"}, max: 7, want: "feature"},
+		{writes: []string{"日本語テキスト"}, max: 3, want: "日本語"},
+		{writes: []string{"no limit"}, max: 0, want: "no limit"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w := &promptWriter{w: &buf, max: tt.max}
+		for _, s := range tt.writes {
+			if n, err := io.WriteString(w, s); err != nil || n != len(s) {
+				t.Errorf("Write(%q) = %d, %v", s, n, err)
+			}
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%q (max=%d): got %q, want %q", tt.writes, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestCacheCmd_Run_prompt(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh is not available")
+	}
+	bin, cleanup, err := prepareBinary(t)
+	defer cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	stdout := new(bytes.Buffer)
+	cachecmd := CacheCmd{
+		stdout:       stdout,
+		stderr:       ioutil.Discard,
+		cmdName:      "sh",
+		cmdArgs:      []string{"-c", "echo main; echo second; echo error >&2"},
+		opt:          option{ttl: time.Minute, cacheDir: tmpdir, prompt: true, promptMaxLength: defaultPromptMaxLength},
+		cachecmdExec: bin,
+	}
+	code, err := cachecmd.Run(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != exitCodeNoCache || stdout.Len() != 0 {
+		t.Errorf("got exit code %d and output %q for cold cache, want %d without output", code, stdout, exitCodeNoCache)
+	}
+
+	// Wait for the background update.
+	deadline := time.Now().Add(10 * time.Second)
+	for !fileexists(cachecmd.cacheFilePath() + ".ENTRY") {
+		if time.Now().After(deadline) {
+			t.Fatal("cache is not populated in background")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	for isLocked(cachecmd.cacheFilePath()+".LOCK", cachecmd.opt.lockMode) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	stdout.Reset()
+	if code, err := cachecmd.Run(context.TODO()); code != 0 || err != nil {
+		t.Fatalf("got %d, %v", code, err)
+	}
+	if got, want := stdout.String(), "main"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
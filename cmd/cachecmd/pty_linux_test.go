@@ -0,0 +1,115 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestCacheCmd_Run_pty(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+
+	stdout1 := new(bytes.Buffer)
+	cachecmd := CacheCmd{
+		stdout:  stdout1,
+		stderr:  ioutil.Discard,
+		cmdName: "sh",
+		cmdArgs: []string{"-c", "if [ -t 1 ]; then echo tty; else echo notty; fi; echo err >&2; date +%N"},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir, pty: true},
+	}
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if got := stdout1.String(); !strings.HasPrefix(got, "tty\r\nerr\r\n") {
+		t.Errorf("got %q, want output on terminal", got)
+	}
+
+	stdout2 := new(bytes.Buffer)
+	cachecmd.stdout = stdout2
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if stdout1.String() != stdout2.String() {
+		t.Errorf("got %q, want cached result %q", stdout2.String(), stdout1.String())
+	}
+}
+
+// openPTYSlave returns the slave side of a new pseudo-terminal and closes
+// both sides by the returned function.
+func openPTYSlave(t *testing.T) (*os.File, func()) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("pty is not available: %v", err)
+	}
+	var n uint32
+	var unlock int32
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioctl(master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		t.Fatal(err)
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return slave, func() {
+		slave.Close()
+		master.Close()
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	slave, closePTY := openPTYSlave(t)
+	defer closePTY()
+	if !isTerminal(slave) {
+		t.Error("pty is not a terminal")
+	}
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	if isTerminal(devNull) {
+		t.Errorf("%s is a terminal", os.DevNull)
+	}
+}
+
+func TestCacheCmd_Run_timeout_terminal(t *testing.T) {
+	slave, closePTY := openPTYSlave(t)
+	defer closePTY()
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	// The command is not in its own process group with the terminal, so the
+	// grandchild is not killed and keeps stdout open.
+	cachecmd := CacheCmd{
+		stdin:   slave,
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "sh",
+		cmdArgs: []string{"-c", "sleep 10; echo x"},
+		opt:     option{ttl: 0, cacheDir: tmpdir, timeout: 200 * time.Millisecond},
+	}
+	start := time.Now()
+	code, err := cachecmd.Run(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != exitCodeTimeout {
+		t.Errorf("got exit code %d, want %d", code, exitCodeTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cachecmd waited for the grandchild: %v", elapsed)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func startPTY(cmd *exec.Cmd) (*os.File, error) {
+	return nil, errors.New("-pty is not supported on this platform")
+}
+
+func isPTYClosed(err error) bool {
+	return false
+}
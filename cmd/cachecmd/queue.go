@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Background updates are persisted in cache directory so that `cachecmd
+// schedule` resumes them after cachecmd or the machine restarts. Refresh specs
+// of -async are removed after the updates finish instead of when they start,
+// and commands in the queue of `cachecmd schedule` are saved to
+// scheduleQueueFile.
+
+// refreshSpecPrefix is the prefix of refresh spec files of -async.
+const refreshSpecPrefix = "tmp_cachecmd_refresh_"
+
+// scheduleQueueFile is the file name of the queue of `cachecmd schedule` in
+// cache directory.
+const scheduleQueueFile = "schedule.queue"
+
+// pendingRefreshSpecs returns refresh spec files left in cache directory dir
+// and its namespace directories.
+func pendingRefreshSpecs(dir string) ([]string, error) {
+	var specs []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() && strings.HasPrefix(fi.Name(), refreshSpecPrefix) {
+			specs = append(specs, path)
+		}
+		return nil
+	})
+	return specs, err
+}
+
+// resumeRefreshSpecs runs background updates of -async which were interrupted
+// one by one. Updates running now are not run twice since the entries are
+// locked.
+func resumeRefreshSpecs(logger *log.Logger, dir string) {
+	specs, err := pendingRefreshSpecs(dir)
+	if err != nil {
+		logger.Printf("failed to find interrupted refresh: %v", err)
+		return
+	}
+	for _, path := range specs {
+		logger.Printf("resume refresh %s", filepath.Base(path))
+		refreshBySpec(logger, path)
+	}
+}
+
+// save writes commands in the queue to the file of q.path. It must be called
+// with q.mu held.
+func (q *refreshQueue) save() {
+	if q.path == "" {
+		return
+	}
+	lines := make([]string, 0, len(q.pending))
+	for line := range q.pending {
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	if err := writeScheduleQueue(q.path, lines); err != nil {
+		q.logger.Print(err)
+	}
+}
+
+func writeScheduleQueue(path string, lines []string) error {
+	f, err := createAtomicFile(path, defaultFileMode, false)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(lines); err != nil {
+		f.abort()
+		return fmt.Errorf("failed to write schedule queue: %v", err)
+	}
+	return f.commit()
+}
+
+// restore queues entries which were in the queue saved to the file of q.path
+// when `cachecmd schedule` stopped. Commands removed from the config file are
+// not queued.
+func (q *refreshQueue) restore(entries []scheduleEntry) {
+	b, err := ioutil.ReadFile(q.path)
+	if os.IsNotExist(err) {
+		return
+	}
+	var lines []string
+	if err == nil {
+		err = json.Unmarshal(b, &lines)
+	}
+	if err != nil {
+		q.logger.Printf("failed to read schedule queue: %v", err)
+		return
+	}
+	saved := make(map[string]bool)
+	for _, line := range lines {
+		saved[line] = true
+	}
+	for _, e := range entries {
+		if saved[e.line] && q.push(e.commandEntry) {
+			q.logger.Printf("resume refresh %q", e.line)
+		}
+	}
+}
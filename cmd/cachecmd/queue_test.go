@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResumeRefreshSpecs(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	opt, err := resolveCacheKey(option{ttl: time.Minute, cacheDir: tmpdir, namespace: "proj1"}, "echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := CacheCmd{cmdName: "echo", cmdArgs: []string{"hello"}, opt: opt}
+	if err := c.makeCacheDir(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(c.refreshSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := filepath.Join(opt.cacheDir, refreshSpecPrefix+"1")
+	if err := ioutil.WriteFile(spec, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	specs, err := pendingRefreshSpecs(tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 1 || specs[0] != spec {
+		t.Fatalf("pendingRefreshSpecs() = %v, want [%s]", specs, spec)
+	}
+	resumeRefreshSpecs(log.New(ioutil.Discard, "", 0), tmpdir)
+	if !fileexists(c.cacheFilePath() + ".ENTRY") {
+		t.Error("interrupted refresh is not resumed")
+	}
+	if fileexists(spec) {
+		t.Error("refresh spec is not removed after the update")
+	}
+}
+
+func TestRefreshQueue_restore(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	path := filepath.Join(tmpdir, scheduleQueueFile)
+	logger := log.New(ioutil.Discard, "", 0)
+	entries := []scheduleEntry{
+		{commandEntry: commandEntry{line: "a"}},
+		{commandEntry: commandEntry{line: "b"}},
+		{commandEntry: commandEntry{line: "c"}},
+	}
+
+	// Queue a and c, which are not run before the queue stops.
+	q1 := newRefreshQueue(logger, 1, len(entries))
+	q1.path = path
+	q1.push(entries[0].commandEntry)
+	q1.push(entries[2].commandEntry)
+
+	q2 := newRefreshQueue(logger, 1, len(entries))
+	q2.path = path
+	done := make(chan string, len(entries))
+	q2.refresh = func(_ *log.Logger, e commandEntry) { done <- e.line }
+	// c is removed from the config file.
+	q2.restore(entries[:2])
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q2.start(ctx)
+	if got := <-done; got != "a" {
+		t.Errorf("resumed %q, want %q", got, "a")
+	}
+	select {
+	case got := <-done:
+		t.Errorf("resumed %q, want only %q", got, "a")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// redactRule is a rule to redact secrets in output of the command before it's
+// written to cache.
+type redactRule struct {
+	// Pattern is regular expression of secrets (e.g. "AKIA[0-9A-Z]{16}").
+	Pattern string `json:"pattern"`
+	// Replace is replacement of matched text. $1 is expanded to the submatch.
+	// (default: [REDACTED])
+	Replace string `json:"replace,omitempty"`
+}
+
+const defaultRedactReplace = "[REDACTED]"
+
+type compiledRedactRule struct {
+	re      *regexp.Regexp
+	replace []byte
+}
+
+// redactor redacts secrets in output by rules.
+type redactor []compiledRedactRule
+
+func compileRedactRules(rules []redactRule) (redactor, error) {
+	var r redactor
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %v", rule.Pattern, err)
+		}
+		replace := rule.Replace
+		if replace == "" {
+			replace = defaultRedactReplace
+		}
+		r = append(r, compiledRedactRule{re: re, replace: []byte(replace)})
+	}
+	return r, nil
+}
+
+func (r redactor) redact(b []byte) []byte {
+	for _, rule := range r {
+		b = rule.re.ReplaceAll(b, rule.replace)
+	}
+	return b
+}
+
+// maxRedactLineLen is the max length of a line which redactWriter buffers.
+// Longer lines are redacted in chunks of the length not to use unbounded
+// memory for output without newlines, so secrets across chunks are not
+// redacted.
+const maxRedactLineLen = 64 << 10
+
+// redactWriter redacts output line by line and writes it to w, so that secrets
+// split into multiple writes are redacted. Close must be called to write the
+// last line without newline.
+type redactWriter struct {
+	w   io.Writer
+	r   redactor
+	buf []byte
+}
+
+func newRedactWriter(w io.Writer, r redactor) *redactWriter {
+	return &redactWriter{w: w, r: r}
+}
+
+func (rw *redactWriter) Write(p []byte) (int, error) {
+	rw.buf = append(rw.buf, p...)
+	i := bytes.LastIndexByte(rw.buf, '\n')
+	if i < 0 {
+		if len(rw.buf) < maxRedactLineLen {
+			return len(p), nil
+		}
+		i = len(rw.buf) - 1
+	}
+	if _, err := rw.w.Write(rw.r.redact(rw.buf[:i+1])); err != nil {
+		return 0, err
+	}
+	rw.buf = append(rw.buf[:0], rw.buf[i+1:]...)
+	return len(p), nil
+}
+
+func (rw *redactWriter) Close() error {
+	if len(rw.buf) == 0 {
+		return nil
+	}
+	_, err := rw.w.Write(rw.r.redact(rw.buf))
+	rw.buf = nil
+	return err
+}
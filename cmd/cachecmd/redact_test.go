@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactWriter(t *testing.T) {
+	r, err := compileRedactRules([]redactRule{
+		{Pattern: `AKIA[0-9A-Z]{16}`},
+		{Pattern: `(Bearer) \S+`, Replace: "$1 ***"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	w := newRedactWriter(buf, r)
+	// Secrets split into multiple writes.
+	io.WriteString(w, "key=AKIAABCDEFGH")
+	io.WriteString(w, "IJKLMNOP\nAuthorization: Bearer ")
+	io.WriteString(w, "abc.def")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "key=[REDACTED]\nAuthorization: Bearer ***"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRedactWriter_longLine(t *testing.T) {
+	r, err := compileRedactRules([]redactRule{{Pattern: `secret`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	w := newRedactWriter(buf, r)
+	chunk := strings.Repeat("x", 1024)
+	for i := 0; i < 2*maxRedactLineLen/len(chunk); i++ {
+		io.WriteString(w, chunk)
+		if len(w.buf) > maxRedactLineLen {
+			t.Fatalf("buffered %d bytes of a line without newline", len(w.buf))
+		}
+	}
+	if buf.Len() == 0 {
+		t.Error("long line is not written before Close")
+	}
+}
+
+func TestCompileRedactRules_invalid(t *testing.T) {
+	if _, err := compileRedactRules([]redactRule{{Pattern: "("}}); err == nil {
+		t.Error("got nil error for invalid pattern")
+	}
+}
+
+func TestCacheCmd_Run_redact(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	for i, want := range []string{"token=secret\n", "token=[REDACTED]\n"} {
+		stdout := new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  stdout,
+			stderr:  ioutil.Discard,
+			cmdName: "echo",
+			cmdArgs: []string{"token=secret"},
+			opt: option{ttl: time.Minute, cacheDir: tmpdir,
+				redact: []redactRule{{Pattern: "secret"}}},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		if got := stdout.String(); got != want {
+			t.Errorf("#%d: got %q, want %q", i, got, want)
+		}
+	}
+}
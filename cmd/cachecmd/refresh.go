@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBgLogSize is the size of background update log file to truncate it.
+const maxBgLogSize = 1 << 20
+
+// refreshSpec describes a background cache update. It's passed to the
+// background process as a file instead of reconstructing command line
+// arguments.
+type refreshSpec struct {
+	CmdName   string
+	CmdArgs   []string
+	StdinData []byte
+
+	CacheDir    string
+	CacheKey    string
+	Namespace   string
+	Backend     string
+	Lease       time.Duration
+	Jitter      time.Duration
+	HMACKeyFile string
+	LockMode    string
+	Fsync       bool
+	SharedDir   string
+	Mode        os.FileMode
+	Hash        string
+	TTL         time.Duration
+	MinInterval time.Duration
+	Debounce    time.Duration
+
+	OnRefreshError      string
+	OnRefreshErrorAfter int
+
+	AdaptiveTTL bool
+	MinTTL      time.Duration
+	MaxTTL      time.Duration
+
+	MinRuntime time.Duration
+	AuditLog   string
+	PTY        bool
+	Combine    bool
+	NoStderr   bool
+	Compress   string
+	Redact     []redactRule
+	Normalize  []normalizeRule
+	History    int
+	OnChange   string
+	OnMiss     string
+	OnStore    string
+	Filter     string
+
+	MaxOutputSize  int64
+	RlimitCPU      time.Duration
+	RlimitAS       int64
+	RlimitNofile   int
+	Runner         string
+	GCProbability  float64
+	MaxCacheSize   int64
+	Eviction       string
+	Timeout        time.Duration
+	StaleOnTimeout bool
+}
+
+// refreshSpec returns refreshSpec of c. The password of -backend is not
+// included, and it's passed by backendPasswordEnv instead.
+func (c *CacheCmd) refreshSpec() refreshSpec {
+	backend, _ := splitBackendPassword(c.opt.backend)
+	return refreshSpec{
+		CmdName:     c.cmdName,
+		CmdArgs:     c.cmdArgs,
+		StdinData:   c.stdinData,
+		CacheDir:    c.opt.cacheDir,
+		CacheKey:    c.opt.cacheKey,
+		Namespace:   c.opt.namespace,
+		Backend:     backend,
+		Lease:       c.opt.lease,
+		Jitter:      c.opt.jitter,
+		HMACKeyFile: c.opt.hmacKeyFile,
+		LockMode:    c.opt.lockMode,
+		Fsync:       c.opt.fsync,
+		SharedDir:   c.opt.sharedDir,
+		Mode:        c.opt.mode,
+		Hash:        c.opt.hash,
+		TTL:         c.opt.ttl,
+		MinInterval: c.opt.minInterval,
+		Debounce:    c.opt.debounce,
+
+		OnRefreshError:      c.opt.onRefreshError,
+		OnRefreshErrorAfter: c.opt.onRefreshErrorAfter,
+
+		AdaptiveTTL: c.opt.adaptiveTTL,
+		MinTTL:      c.opt.minTTL,
+		MaxTTL:      c.opt.maxTTL,
+
+		MinRuntime: c.opt.minRuntime,
+		AuditLog:   c.opt.auditLog,
+		PTY:        c.opt.pty,
+		Combine:    c.opt.combine,
+		NoStderr:   c.opt.noStderr,
+		Compress:   c.opt.compress,
+		Redact:     c.opt.redact,
+		Normalize:  c.opt.normalize,
+		History:    c.opt.history,
+		OnChange:   c.opt.onChange,
+		OnMiss:     c.opt.onMiss,
+		OnStore:    c.opt.onStore,
+		Filter:     c.opt.filter,
+
+		MaxOutputSize:  c.opt.maxOutputSize,
+		RlimitCPU:      c.opt.rlimits.cpu,
+		RlimitAS:       c.opt.rlimits.as,
+		RlimitNofile:   c.opt.rlimits.nofile,
+		Runner:         c.opt.runner,
+		GCProbability:  c.opt.gcProbability,
+		MaxCacheSize:   c.opt.maxCacheSize,
+		Eviction:       c.opt.eviction,
+		Timeout:        c.opt.timeout,
+		StaleOnTimeout: c.opt.staleOnTimeout,
+	}
+}
+
+func (s refreshSpec) cacheCmd() CacheCmd {
+	return CacheCmd{
+		stdout:    ioutil.Discard,
+		stderr:    ioutil.Discard,
+		cmdName:   s.CmdName,
+		cmdArgs:   s.CmdArgs,
+		stdinData: s.StdinData,
+		opt: option{
+			ttl:         s.TTL,
+			minInterval: s.MinInterval,
+			refresh:     true,
+			cacheDir:    s.CacheDir,
+			cacheKey:    s.CacheKey,
+			namespace:   s.Namespace,
+			backend:     s.Backend,
+			lease:       s.Lease,
+			jitter:      s.Jitter,
+			hmacKeyFile: s.HMACKeyFile,
+			hash:        s.Hash,
+			// Do nothing if other update process is running.
+			inflight:  inflightStale,
+			lockMode:  s.LockMode,
+			fsync:     s.Fsync,
+			sharedDir: s.SharedDir,
+			mode:      s.Mode,
+
+			onRefreshError:      s.OnRefreshError,
+			onRefreshErrorAfter: s.OnRefreshErrorAfter,
+
+			adaptiveTTL: s.AdaptiveTTL,
+			minTTL:      s.MinTTL,
+			maxTTL:      s.MaxTTL,
+
+			minRuntime: s.MinRuntime,
+			auditLog:   s.AuditLog,
+			trigger:    triggerAsync,
+			pty:        s.PTY,
+			combine:    s.Combine,
+			noStderr:   s.NoStderr,
+			compress:   s.Compress,
+			redact:     s.Redact,
+			normalize:  s.Normalize,
+			history:    s.History,
+			onChange:   s.OnChange,
+			onMiss:     s.OnMiss,
+			onStore:    s.OnStore,
+			filter:     s.Filter,
+
+			maxOutputSize:  s.MaxOutputSize,
+			rlimits:        rlimits{cpu: s.RlimitCPU, as: s.RlimitAS, nofile: s.RlimitNofile},
+			runner:         s.Runner,
+			gcProbability:  s.GCProbability,
+			maxCacheSize:   s.MaxCacheSize,
+			eviction:       s.Eviction,
+			timeout:        s.Timeout,
+			staleOnTimeout: s.StaleOnTimeout,
+		},
+	}
+}
+
+// startUpdateCache spawns a detached cachecmd process which updates cache in
+// background.
+func (c *CacheCmd) startUpdateCache() error {
+	f, err := ioutil.TempFile(c.opt.cacheDir, refreshSpecPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	err = json.NewEncoder(f).Encode(c.refreshSpec())
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write refresh spec: %v", err)
+	}
+
+	logf, err := openBgLog(c.bgLogPath(), c.fileMode())
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	defer logf.Close()
+
+	cmd := exec.Command(c.cachecmdExecutable(), "-internal-refresh", f.Name())
+	cmd.SysProcAttr = detachSysProcAttr()
+	if _, password := splitBackendPassword(c.opt.backend); password != "" {
+		cmd.Env = append(os.Environ(), backendPasswordEnv+"="+password)
+	}
+	// The background process writes stderr of the command and the result of
+	// update to its stderr.
+	cmd.Stderr = logf
+	if err := cmd.Start(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+func (c *CacheCmd) bgLogPath() string {
+	if c.opt.bgLog != "" {
+		return c.opt.bgLog
+	}
+	return filepath.Join(c.opt.cacheDir, "refresh.log")
+}
+
+// openBgLog opens background update log file to append. It truncates the log
+// file if it's too large. The file is created with permission perm.
+func openBgLog(path string, perm os.FileMode) (*os.File, error) {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if stat, err := os.Stat(path); err == nil && stat.Size() > maxBgLogSize {
+		flag |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flag, perm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open background log: %v", err)
+	}
+	return f, nil
+}
+
+// cachecmdExecutable returns path of cachecmd executable for background
+// update.
+func (c *CacheCmd) cachecmdExecutable() string {
+	if c.cachecmdExec != "" {
+		return c.cachecmdExec
+	}
+	if exe, err := os.Executable(); err == nil {
+		return exe
+	}
+	return os.Args[0]
+}
+
+// runInternalRefresh updates cache as described by the given refresh spec
+// file. Stderr of the command and the result are written to stderr, which is
+// background update log.
+func runInternalRefresh(path string) (int, error) {
+	// Already logged.
+	return refreshBySpec(log.New(os.Stderr, "cachecmd: ", log.LstdFlags), path), nil
+}
+
+// refreshBySpec updates cache as described by the given refresh spec file and
+// logs the result to logger. The file is removed after the update finishes so
+// that it's resumed if the update is interrupted (see resumeRefreshSpecs).
+func refreshBySpec(logger *log.Logger, path string) int {
+	defer os.Remove(path)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.Printf("failed to read refresh spec: %v", err)
+		return 1
+	}
+	var spec refreshSpec
+	if err := json.Unmarshal(b, &spec); err != nil {
+		logger.Printf("failed to parse refresh spec: %v", err)
+		return 1
+	}
+	cachecmd := spec.cacheCmd()
+	cachecmd.stderr = os.Stderr
+	if err := loadHMACKey(&cachecmd.opt); err != nil {
+		logger.Print(err)
+		return 1
+	}
+	// Wait for the burst of invocations to settle with -debounce.
+	time.Sleep(spec.Debounce)
+	command := strings.Join(append([]string{spec.CmdName}, spec.CmdArgs...), " ")
+	start := time.Now()
+	code, err := cachecmd.Run(context.Background())
+	elapsed := time.Since(start)
+	if err != nil {
+		logger.Printf("refresh %q failed: exit=%d duration=%v error=%v", command, code, elapsed, err)
+	} else {
+		logger.Printf("refresh %q: exit=%d duration=%v", command, code, elapsed)
+	}
+	if err := cachecmd.recordRefreshResult(code, err); err != nil {
+		logger.Print(err)
+	}
+	return code
+}
+
+// recordRefreshResult records consecutive failures of background update and
+// notifies it by -on-refresh-error hook if it reaches the threshold.
+func (c *CacheCmd) recordRefreshResult(code int, runErr error) error {
+	path := c.cacheFilePath() + ".FAILURES"
+	if runErr == nil && code == 0 {
+		os.Remove(path)
+		return nil
+	}
+	b, _ := ioutil.ReadFile(path)
+	failures, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	failures++
+	if err := ioutil.WriteFile(path, []byte(strconv.Itoa(failures)), c.fileMode()); err != nil {
+		return fmt.Errorf("failed to record failure: %v", err)
+	}
+	if c.opt.onRefreshError == "" || failures < c.opt.onRefreshErrorAfter {
+		return nil
+	}
+	errMsg := ""
+	if runErr != nil {
+		errMsg = runErr.Error()
+	}
+	return runHook(c.opt.onRefreshError, hookEvent{
+		Event:    "refresh_error",
+		Command:  append([]string{c.cmdName}, c.cmdArgs...),
+		Key:      c.opt.cacheKey,
+		ExitCode: code,
+		Error:    errMsg,
+		Failures: failures,
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resource limits of the command are set by the cachecmd process started with
+// -internal-rlimit between cachecmd and the command, which sets the limits to
+// itself and execs the command, so that the limits do not affect cachecmd.
+
+// rlimits is resource limits of the command. Zero values mean no limit.
+type rlimits struct {
+	// cpu is CPU time, which is rounded up to seconds.
+	cpu time.Duration
+	// as is the size of address space (virtual memory) in bytes.
+	as int64
+	// nofile is the number of open files.
+	nofile int
+}
+
+func (l rlimits) isSet() bool {
+	return l.cpu > 0 || l.as > 0 || l.nofile > 0
+}
+
+// cpuSeconds returns the CPU time limit in seconds.
+func (l rlimits) cpuSeconds() uint64 {
+	return uint64((l.cpu + time.Second - 1) / time.Second)
+}
+
+// String returns the limits in the format of -internal-rlimit (e.g.
+// cpu=30,as=1073741824,nofile=256).
+func (l rlimits) String() string {
+	var fields []string
+	if l.cpu > 0 {
+		fields = append(fields, "cpu="+strconv.FormatUint(l.cpuSeconds(), 10))
+	}
+	if l.as > 0 {
+		fields = append(fields, "as="+strconv.FormatInt(l.as, 10))
+	}
+	if l.nofile > 0 {
+		fields = append(fields, "nofile="+strconv.Itoa(l.nofile))
+	}
+	return strings.Join(fields, ",")
+}
+
+// parseRlimits parses the limits formatted by rlimits.String.
+func parseRlimits(s string) (rlimits, error) {
+	var l rlimits
+	for _, field := range strings.Split(s, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return l, fmt.Errorf("invalid resource limit: %q", field)
+		}
+		n, err := strconv.ParseInt(kv[1], 10, 64)
+		if err != nil || n < 0 {
+			return l, fmt.Errorf("invalid resource limit: %q", field)
+		}
+		switch kv[0] {
+		case "cpu":
+			l.cpu = time.Duration(n) * time.Second
+		case "as":
+			l.as = n
+		case "nofile":
+			l.nofile = int(n)
+		default:
+			return l, fmt.Errorf("unknown resource limit: %q", kv[0])
+		}
+	}
+	return l, nil
+}
+
+// runInternalRlimit sets the resource limits and execs the command. It returns
+// only if it fails.
+func runInternalRlimit(spec string, command []string) (int, error) {
+	if len(command) == 0 {
+		return 2, errors.New("-internal-rlimit requires command")
+	}
+	l, err := parseRlimits(spec)
+	if err != nil {
+		return 2, err
+	}
+	if err := setRlimits(l); err != nil {
+		return 126, fmt.Errorf("failed to set resource limits: %v", err)
+	}
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		return 127, err
+	}
+	if err := execve(path, command); err != nil {
+		return 126, fmt.Errorf("failed to exec %s: %v", command[0], err)
+	}
+	return 0, nil
+}
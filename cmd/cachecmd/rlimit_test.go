@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParseRlimits(t *testing.T) {
+	l := rlimits{cpu: 1500 * time.Millisecond, as: 1 << 30, nofile: 256}
+	s := l.String()
+	if want := "cpu=2,as=1073741824,nofile=256"; s != want {
+		t.Errorf("String() = %q, want %q", s, want)
+	}
+	got, err := parseRlimits(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (rlimits{cpu: 2 * time.Second, as: 1 << 30, nofile: 256}); got != want {
+		t.Errorf("parseRlimits(%q) = %+v, want %+v", s, got, want)
+	}
+	for _, s := range []string{"", "cpu", "cpu=-1", "mem=1"} {
+		if _, err := parseRlimits(s); err == nil {
+			t.Errorf("parseRlimits(%q) = nil error, want error", s)
+		}
+	}
+}
+
+func TestCacheCmd_Run_rlimit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("resource limits are not supported on Windows")
+	}
+	bin, cleanup, err := prepareBinary(t)
+	defer cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	stdout := new(bytes.Buffer)
+	cachecmd := CacheCmd{
+		stdout:       stdout,
+		stderr:       ioutil.Discard,
+		cmdName:      "sh",
+		cmdArgs:      []string{"-c", "ulimit -n"},
+		opt:          option{ttl: time.Minute, cacheDir: tmpdir, rlimits: rlimits{nofile: 100}},
+		cachecmdExec: bin,
+	}
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stdout.String(), "100\n"; got != want {
+		t.Errorf("ulimit -n = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// sshRunner runs the command on a remote host over SSH while its output is
+// cached locally. Environment variables set by cachecmd (e.g.
+// CACHECMD_CONTROL) are not passed to the remote command.
+type sshRunner struct {
+	ssh  string
+	dest string
+	port string
+	// dir is the working directory on the host. Empty means the home
+	// directory.
+	dir string
+}
+
+// command returns the command to run. It runs the command on the host of
+// -runner, or via cachecmd with -internal-rlimit if resource limits are given.
+func (c *CacheCmd) command(ctx context.Context) *exec.Cmd {
+	if r, _ := newRunner(c.opt.runner); r != nil {
+		return r.command(ctx, c.cmdName, c.cmdArgs, c.opt.pty)
+	}
+	if !c.opt.rlimits.isSet() {
+		return exec.CommandContext(ctx, c.cmdName, c.cmdArgs...)
+	}
+	args := append([]string{"-internal-rlimit=" + c.opt.rlimits.String(), "--", c.cmdName}, c.cmdArgs...)
+	return exec.CommandContext(ctx, c.cachecmdExecutable(), args...)
+}
+
+// newRunner returns sshRunner of -runner like ssh://user@host:port/path. It
+// returns nil for empty -runner, which runs the command locally.
+func newRunner(rawurl string) (*sshRunner, error) {
+	if rawurl == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Scheme != "ssh" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid -runner: %q", rawurl)
+	}
+	dest := u.Hostname()
+	if u.User != nil {
+		dest = u.User.Username() + "@" + dest
+	}
+	return &sshRunner{ssh: "ssh", dest: dest, port: u.Port(), dir: u.Path}, nil
+}
+
+// command returns ssh command which runs the command on the host. The command
+// gets a terminal on the host if tty is true.
+func (r *sshRunner) command(ctx context.Context, name string, args []string, tty bool) *exec.Cmd {
+	words := []string{shellQuote(name)}
+	for _, arg := range args {
+		words = append(words, shellQuote(arg))
+	}
+	script := "exec " + strings.Join(words, " ")
+	if r.dir != "" {
+		script = "cd " + shellQuote(r.dir) + " && " + script
+	}
+	sshArgs := []string{"-o", "BatchMode=yes"}
+	if tty {
+		sshArgs = append(sshArgs, "-t")
+	}
+	if r.port != "" {
+		sshArgs = append(sshArgs, "-p", r.port)
+	}
+	sshArgs = append(sshArgs, r.dest, script)
+	return exec.CommandContext(ctx, r.ssh, sshArgs...)
+}
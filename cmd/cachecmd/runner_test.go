@@ -0,0 +1,75 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewRunner(t *testing.T) {
+	r, err := newRunner("ssh://user@bastion:2222/srv/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &sshRunner{ssh: "ssh", dest: "user@bastion", port: "2222", dir: "/srv/app"}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("got %+v, want %+v", r, want)
+	}
+	if r, err := newRunner(""); r != nil || err != nil {
+		t.Errorf("newRunner(\"\") = %v, %v, want nil", r, err)
+	}
+	for _, url := range []string{"bastion", "ssh:///path", "https://bastion"} {
+		if _, err := newRunner(url); err == nil {
+			t.Errorf("newRunner(%q) got nil error", url)
+		}
+	}
+}
+
+func TestSSHRunner_command(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	// Fake ssh runs the remote command locally.
+	fakeSSH := filepath.Join(tmpdir, "ssh")
+	script := "#!/bin/sh\nwhile [ $# -gt 1 ]; do shift; done\nexec sh -c \"$1\"\n"
+	if err := ioutil.WriteFile(fakeSSH, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpdir, "workdir"), []byte("workdir\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := &sshRunner{ssh: fakeSSH, dest: "host", dir: tmpdir}
+	out, err := r.command(context.TODO(), "sh", []string{"-c", `cat workdir; echo "$1"`, "sh", "it's"}, false).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(out), "workdir\nit's\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCacheCmd_Run_runner(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	local, err := resolveCacheKey(option{cacheDir: tmpdir}, "echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := resolveCacheKey(option{cacheDir: tmpdir, runner: "ssh://bastion"}, "echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := CacheCmd{cmdName: "echo", opt: local}
+	b := CacheCmd{cmdName: "echo", opt: remote}
+	if a.cacheFilePath() == b.cacheFilePath() {
+		t.Error("cache of the command run by -runner is shared with the local command")
+	}
+	if code, err := run(nil, ioutil.Discard, ioutil.Discard, option{cacheDir: tmpdir, runner: "bastion"}, []string{"echo"}); err == nil {
+		t.Errorf("run() with invalid -runner = %d, nil error", code)
+	}
+}
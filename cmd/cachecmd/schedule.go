@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+func runSchedule(args []string) (int, error) {
+	fs := newSubFlagSet("schedule", "cachecmd schedule [-config file] [-j jobs] [flags]",
+		"cachecmd schedule runs commands in \"schedule\" of the config file on their cron-like\n"+
+			"schedules and keeps their cache fresh. It runs until interrupted. Due commands wait in\n"+
+			"the queue while -j commands are running, and a command is not queued again until it's run.\n"+
+			"The queue and interrupted background updates of -async are resumed when it restarts.")
+	cfgPath := fs.String("config", configPath(), "config file.")
+	jobs := fs.Int("j", runtime.NumCPU(), "number of commands to run concurrently.")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	cfg, err := loadConfig(*cfgPath)
+	if err != nil {
+		return 1, err
+	}
+	applyConfig(flagOpt, cfg)
+	entries, err := parseScheduleEntries(cfg.Schedule, *flagOpt)
+	if err != nil {
+		return 2, err
+	}
+	if len(entries) == 0 {
+		return 1, fmt.Errorf("no schedule in %s", *cfgPath)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	logger := log.New(os.Stderr, "cachecmd: ", log.LstdFlags)
+	dir, err := optionCacheDir(*flagOpt)
+	if err != nil {
+		return 2, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return 1, fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	queue := newRefreshQueue(logger, *jobs, len(entries))
+	queue.path = filepath.Join(dir, scheduleQueueFile)
+	queue.restore(entries)
+	queue.start(ctx)
+	go resumeRefreshSpecs(logger, dir)
+	scheduleLoop(ctx, queue, entries)
+	return 0, nil
+}
+
+// scheduleEntry is a command to run on the schedule.
+type scheduleEntry struct {
+	commandEntry
+	schedule *cronSchedule
+}
+
+func parseScheduleEntries(cfgs []scheduleConfig, opt option) ([]scheduleEntry, error) {
+	var entries []scheduleEntry
+	for _, c := range cfgs {
+		sched, err := parseCron(c.Cron)
+		if err != nil {
+			return nil, err
+		}
+		e, err := parseCommandEntry(c.Command, opt)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %v", c.Command, err)
+		}
+		entries = append(entries, scheduleEntry{commandEntry: e, schedule: sched})
+	}
+	return entries, nil
+}
+
+// dueEntries returns entries which are scheduled at the minute of t.
+func dueEntries(entries []scheduleEntry, t time.Time) []scheduleEntry {
+	var due []scheduleEntry
+	for _, e := range entries {
+		if e.schedule.matches(t) {
+			due = append(due, e)
+		}
+	}
+	return due
+}
+
+// scheduleLoop queues due entries every minute until ctx is done.
+func scheduleLoop(ctx context.Context, queue *refreshQueue, entries []scheduleEntry) {
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(next.Sub(now)):
+		}
+		for _, e := range dueEntries(entries, next) {
+			if !queue.push(e.commandEntry) {
+				queue.logger.Printf("skip %q: previous refresh has not finished", e.line)
+			}
+		}
+	}
+}
+
+// refreshQueue updates cache of queued commands with at most jobs commands at a
+// time. A command is not queued while it's queued or running.
+type refreshQueue struct {
+	logger  *log.Logger
+	jobs    int
+	queue   chan commandEntry
+	refresh func(*log.Logger, commandEntry)
+	// path is the file to save the queue to if it's not empty.
+	path string
+
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+// newRefreshQueue returns refreshQueue which holds at most size commands.
+func newRefreshQueue(logger *log.Logger, jobs, size int) *refreshQueue {
+	if jobs < 1 {
+		jobs = 1
+	}
+	return &refreshQueue{
+		logger:  logger,
+		jobs:    jobs,
+		queue:   make(chan commandEntry, size),
+		refresh: refreshEntry,
+		pending: make(map[string]bool),
+	}
+}
+
+// start starts workers which run queued commands until ctx is done.
+func (q *refreshQueue) start(ctx context.Context) {
+	for i := 0; i < q.jobs; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case e := <-q.queue:
+					q.refresh(q.logger, e)
+					q.mu.Lock()
+					delete(q.pending, e.line)
+					q.save()
+					q.mu.Unlock()
+				}
+			}
+		}()
+	}
+}
+
+// push queues the command. It returns false if the same command is already
+// queued or running, or if the queue is full.
+func (q *refreshQueue) push(e commandEntry) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending[e.line] {
+		return false
+	}
+	select {
+	case q.queue <- e:
+		q.pending[e.line] = true
+		q.save()
+		return true
+	default:
+		return false
+	}
+}
+
+// refreshEntry runs the command and updates its cache regardless of TTL.
+func refreshEntry(logger *log.Logger, e commandEntry) {
+	opt := e.opt
+	opt.refresh = true
+	opt.trigger = triggerSchedule
+	start := time.Now()
+	code, sig, err := runCommand(nil, ioutil.Discard, ioutil.Discard, opt, e.command)
+	if err == nil && sig != 0 {
+		err = fmt.Errorf("killed by signal %d", sig)
+	}
+	if err != nil {
+		logger.Printf("refresh %q failed: exit=%d duration=%v error=%v", e.line, code, time.Since(start), err)
+		return
+	}
+	logger.Printf("refresh %q: exit=%d duration=%v", e.line, code, time.Since(start))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDueEntries(t *testing.T) {
+	entries, err := parseScheduleEntries([]scheduleConfig{
+		{Cron: "*/5 * * * *", Command: "hub issue"},
+		{Cron: "0 * * * *", Command: "-key-cwd go list ./..."},
+	}, option{ttl: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		t    string
+		want int
+	}{
+		{t: "2018-05-01 10:03", want: 0},
+		{t: "2018-05-01 10:05", want: 1},
+		{t: "2018-05-01 10:00", want: 2},
+	}
+	for _, tt := range tests {
+		tm, _ := time.Parse("2006-01-02 15:04", tt.t)
+		if got := len(dueEntries(entries, tm)); got != tt.want {
+			t.Errorf("got %d due entries at %s, want %d", got, tt.t, tt.want)
+		}
+	}
+	if !entries[1].opt.keyCwd {
+		t.Error("flags in command are not parsed")
+	}
+}
+
+func TestParseScheduleEntries_invalid(t *testing.T) {
+	if _, err := parseScheduleEntries([]scheduleConfig{{Cron: "* *", Command: "date"}}, option{}); err == nil {
+		t.Error("got nil error for invalid cron")
+	}
+	if _, err := parseScheduleEntries([]scheduleConfig{{Cron: "* * * * *", Command: "-ttl=1m"}}, option{}); err == nil {
+		t.Error("got nil error for missing command")
+	}
+}
+
+func TestRefreshQueue(t *testing.T) {
+	q := newRefreshQueue(log.New(ioutil.Discard, "", 0), 2, 10)
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	done := make(chan string, 10)
+	release := make(chan struct{})
+	q.refresh = func(_ *log.Logger, e commandEntry) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+		done <- e.line
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.start(ctx)
+
+	for _, line := range []string{"a", "b", "c", "d"} {
+		if !q.push(commandEntry{line: line}) {
+			t.Errorf("push(%q) = false, want true", line)
+		}
+	}
+	if q.push(commandEntry{line: "a"}) {
+		t.Error("push() for queued command = true, want false")
+	}
+	close(release)
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+	if maxRunning > 2 {
+		t.Errorf("%d commands ran at a time, want at most 2", maxRunning)
+	}
+	// The worker removes the finished command from the queue after it's done.
+	deadline := time.Now().Add(time.Second)
+	for !q.push(commandEntry{line: "a"}) {
+		if time.Now().After(deadline) {
+			t.Fatal("push() for finished command = false, want true")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+func runSeed(args []string) (int, error) {
+	fs := newSubFlagSet("seed", "cachecmd seed [-exit-code n] [flags] [--] {command}",
+		"cachecmd seed creates cache entry of the command with stdin as its stdout without running\n"+
+			"the command (e.g. some-precomputed-output | cachecmd seed -ttl=1h -- mycmd args).")
+	exitCode := fs.Int("exit-code", 0, "exit code of the command to cache.")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2, nil
+	}
+	opt := *flagOpt
+	// Load "redact" rules and "policy".
+	if err := loadDefaultConfig(&opt); err != nil {
+		return 2, err
+	}
+	if err := validCompress(opt.compress); err != nil {
+		return 2, err
+	}
+	if _, err := compilePolicy(opt.policy); err != nil {
+		return 2, err
+	}
+	if _, err := compileRedactRules(opt.redact); err != nil {
+		return 2, err
+	}
+	if err := loadHMACKey(&opt); err != nil {
+		return 2, err
+	}
+	opt, err := resolveCacheKey(opt, fs.Arg(0))
+	if err != nil {
+		return 1, err
+	}
+	c := &CacheCmd{stdout: os.Stdout, stderr: os.Stderr, cmdName: fs.Arg(0), cmdArgs: fs.Args()[1:], opt: opt}
+	if err := c.makeCacheDir(); err != nil {
+		return 1, err
+	}
+	if err := c.seed(os.Stdin, *exitCode); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// seed writes cache entry of the command whose stdout is read from r and
+// whose exit code is exitCode. The TTL of the entry is -ttl. The stdout is
+// redacted by -redact rules and the entry is also stored to -backend.
+func (c *CacheCmd) seed(r io.Reader, exitCode int) error {
+	if !c.cacheAllowed() {
+		return fmt.Errorf("cache of %q is not allowed by policy", c.cmdName)
+	}
+	remote, err := newBackend(c.opt.backend, c.opt.cacheDir, c.opt.mode)
+	if err != nil {
+		return err
+	}
+	redactor, err := compileRedactRules(c.opt.redact)
+	if err != nil {
+		return err
+	}
+	base := c.cacheFilePath()
+	f, err := createAtomicFile(base+".ENTRY", c.fileMode(), c.opt.fsync)
+	if err != nil {
+		return err
+	}
+	sum := newChecksumWriter(f, c.opt.hmacKey, c.entryName())
+	cw, err := newCompressWriter(c.opt.compress, sum)
+	if err != nil {
+		f.abort()
+		return err
+	}
+	stdoutHash := sha256.New()
+	stdout := newRedactWriter(io.MultiWriter(newStreamWriter(cw).writer(streamStdout), stdoutHash), redactor)
+	if _, err := io.Copy(stdout, r); err != nil {
+		f.abort()
+		return fmt.Errorf("failed to write cache: %v", err)
+	}
+	if err := stdout.Close(); err != nil {
+		f.abort()
+		return fmt.Errorf("failed to write cache: %v", err)
+	}
+	if err := cw.Close(); err != nil {
+		f.abort()
+		return fmt.Errorf("failed to compress cache: %v", err)
+	}
+	meta := entryMeta{
+		ExitCode:    exitCode,
+		CachedAt:    time.Now().UnixNano(),
+		StdoutHash:  fmt.Sprintf("%x", stdoutHash.Sum(nil)),
+		Command:     append([]string{c.cmdName}, c.cmdArgs...),
+		Compression: c.opt.compress,
+		TTL:         c.opt.ttl,
+	}
+	if err := writeEntryMeta(sum, meta); err != nil {
+		f.abort()
+		return fmt.Errorf("failed to write cache: %v", err)
+	}
+	if err := c.saveHistory(base); err != nil {
+		f.abort()
+		return err
+	}
+	if err := f.commit(); err != nil {
+		return err
+	}
+	if remote != nil {
+		return c.storeEntry(remote, base)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_seed(t *testing.T) {
+	for _, compress := range []string{compressNone, compressGzip} {
+		tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+		defer os.RemoveAll(tmpdir)
+		out := filepath.Join(tmpdir, "out")
+		c := CacheCmd{
+			stderr:  ioutil.Discard,
+			cmdName: "touch",
+			cmdArgs: []string{out},
+			opt:     option{ttl: time.Hour, cacheDir: tmpdir, compress: compress},
+		}
+		if err := c.seed(strings.NewReader("seeded\n"), 3); err != nil {
+			t.Fatal(err)
+		}
+		stdout := new(bytes.Buffer)
+		c.stdout = stdout
+		// The seeded TTL is used without -ttl.
+		c.opt.ttl = time.Minute
+		c.clock = fixedClock(time.Now().Add(30 * time.Minute))
+		code, err := c.Run(context.TODO())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fileexists(out) {
+			t.Errorf("%s: command is run instead of using seeded cache", compress)
+		}
+		if code != 3 || stdout.String() != "seeded\n" {
+			t.Errorf("%s: got (%d, %q), want (3, %q)", compress, code, stdout.String(), "seeded\n")
+		}
+	}
+}
+
+func TestCacheCmd_seed_redactBackend(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	opt := option{ttl: time.Hour, cacheDir: filepath.Join(tmpdir, "local1"),
+		backend: filepath.Join(tmpdir, "remote"), backendSync: true,
+		redact: []redactRule{{Pattern: `token=\w+`, Replace: "token=xxx"}}}
+	c := CacheCmd{stderr: ioutil.Discard, cmdName: "false", opt: opt}
+	if err := c.makeCacheDir(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.seed(strings.NewReader("token=secret\n"), 0); err != nil {
+		t.Fatal(err)
+	}
+	// Other machine uses the seeded entry in the backend.
+	stdout := new(bytes.Buffer)
+	c.stdout = stdout
+	c.opt.cacheDir = filepath.Join(tmpdir, "local2")
+	if _, err := c.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stdout.String(), "token=xxx\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCacheCmd_seed_policy(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	c := CacheCmd{stderr: ioutil.Discard, cmdName: "pass", cmdArgs: []string{"show"},
+		opt: option{ttl: time.Hour, cacheDir: tmpdir, policy: cachePolicy{Deny: []string{"^pass "}}}}
+	if err := c.seed(strings.NewReader("secret\n"), 0); err == nil {
+		t.Error("got nil error for denied command")
+	}
+	if fileexists(c.cacheFilePath() + ".ENTRY") {
+		t.Error("entry of denied command is created")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A shared cache directory of -shared-dir (e.g. /var/cache/cachecmd) is
+// world-writable with the sticky bit like /tmp. Each user writes entries only
+// to the subdirectory named by the UID, which is readable by others, and reads
+// entries of trusted users (-shared-trust) in addition to its own entries.
+// Entries of other users are copied to the subdirectory of the user when they
+// are used, so that users never write to the same files.
+
+// defaultSharedTrust is the default value of -shared-trust.
+const defaultSharedTrust = "root"
+
+// sharedUserDir returns the subdirectory of the shared cache directory for the
+// user of uid.
+func sharedUserDir(root string, uid int) string {
+	return filepath.Join(root, strconv.Itoa(uid))
+}
+
+// checkSharedDir returns error if the shared cache directory root is not safe
+// to share with other users on the host.
+func checkSharedDir(root string) error {
+	fi, err := os.Stat(root)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("shared cache directory %s does not exist: create it by `sudo install -d -m 1777 %s`", root, root)
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := fileOwner(fi); !ok {
+		return errors.New("-shared-dir is not supported on this platform")
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("shared cache directory %s is not a directory", root)
+	}
+	if fi.Mode().Perm()&0002 != 0 && fi.Mode()&os.ModeSticky == 0 {
+		return fmt.Errorf("shared cache directory %s is world-writable without the sticky bit: run `chmod +t %s`", root, root)
+	}
+	dir := sharedUserDir(root, os.Getuid())
+	if fi, err := os.Lstat(dir); err == nil {
+		if uid, _ := fileOwner(fi); uid != os.Getuid() || !fi.IsDir() {
+			return fmt.Errorf("%s is not a directory owned by you", dir)
+		}
+	}
+	return nil
+}
+
+// parseSharedTrust returns UIDs of comma-separated user names or UIDs of
+// -shared-trust.
+func parseSharedTrust(s string) ([]int, error) {
+	var uids []int
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if uid, err := strconv.Atoi(name); err == nil {
+			uids = append(uids, uid)
+			continue
+		}
+		if name == "root" {
+			uids = append(uids, 0)
+			continue
+		}
+		u, err := user.Lookup(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -shared-trust: %v", err)
+		}
+		uid, err := strconv.Atoi(u.Uid)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -shared-trust: %q has no UID", name)
+		}
+		uids = append(uids, uid)
+	}
+	return uids, nil
+}
+
+// sharedBackend is read-only backend of entries of other user in the shared
+// cache directory. Files which are not owned by the user or writable by others
+// are ignored not to use entries planted by untrusted users.
+type sharedBackend struct {
+	dir string
+	uid int
+}
+
+func (b sharedBackend) get(name string) (io.ReadCloser, time.Time, error) {
+	if err := b.check(b.dir); err != nil {
+		return nil, time.Time{}, err
+	}
+	p := filepath.Join(b.dir, filepath.FromSlash(name))
+	if d := filepath.Dir(p); d != b.dir {
+		// Namespace directory.
+		if err := b.check(d); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	stat, err := f.Stat()
+	if err == nil {
+		err = b.checkInfo(p, stat)
+	}
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, err
+	}
+	return f, stat.ModTime(), nil
+}
+
+func (b sharedBackend) put(name string, r io.Reader, modTime time.Time) error {
+	return errors.New("shared cache of other user is read-only")
+}
+
+// check makes sure path is not a symlink and owned by the user.
+func (b sharedBackend) check(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	return b.checkInfo(path, fi)
+}
+
+func (b sharedBackend) checkInfo(path string, fi os.FileInfo) error {
+	if uid, ok := fileOwner(fi); !ok || uid != b.uid || fi.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%s is not owned by trusted user %d", path, b.uid)
+	}
+	if fi.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%s is writable by other users", path)
+	}
+	return nil
+}
+
+// sharedBackends returns backends of trusted users of -shared-trust in the
+// shared cache directory.
+func (c *CacheCmd) sharedBackends() ([]backend, error) {
+	uids, err := parseSharedTrust(c.opt.sharedTrust)
+	if err != nil {
+		return nil, err
+	}
+	var bs []backend
+	for _, uid := range uids {
+		if uid == os.Getuid() {
+			continue
+		}
+		bs = append(bs, sharedBackend{dir: sharedUserDir(c.opt.sharedDir, uid), uid: uid})
+	}
+	return bs, nil
+}
+
+// pullShared copies the newest entry of the given base path of trusted users
+// to the subdirectory of the user in the shared cache directory.
+func (c *CacheCmd) pullShared(base string) error {
+	bs, err := c.sharedBackends()
+	if err != nil {
+		return err
+	}
+	for _, b := range bs {
+		if err := c.pullEntry(b, base); err != nil {
+			fmt.Fprintf(c.stderr, "cachecmd: %v\n", err)
+		}
+	}
+	return nil
+}
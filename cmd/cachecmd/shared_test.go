@@ -0,0 +1,125 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckSharedDir(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	root := filepath.Join(tmpdir, "shared")
+
+	if err := checkSharedDir(root); err == nil {
+		t.Error("checkSharedDir() for missing directory = nil, want error")
+	}
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(root, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSharedDir(root); err == nil {
+		t.Error("checkSharedDir() without sticky bit = nil, want error")
+	}
+	if err := os.Chmod(root, 0777|os.ModeSticky); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSharedDir(root); err != nil {
+		t.Errorf("checkSharedDir() = %v", err)
+	}
+	if err := os.Symlink(tmpdir, sharedUserDir(root, os.Getuid())); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSharedDir(root); err == nil {
+		t.Error("checkSharedDir() with symlink of user directory = nil, want error")
+	}
+}
+
+func TestParseSharedTrust(t *testing.T) {
+	got, err := parseSharedTrust("root, 1000,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 1000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSharedTrust() = %v, want %v", got, want)
+	}
+	if _, err := parseSharedTrust("cachecmd-no-such-user"); err == nil {
+		t.Error("parseSharedTrust() for unknown user = nil, want error")
+	}
+}
+
+func TestSharedBackend_get(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	dir := filepath.Join(tmpdir, "1000")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.ENTRY"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := sharedBackend{dir: dir, uid: os.Getuid()}
+	r, _, err := b.get("a.ENTRY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if _, _, err := b.get("b.ENTRY"); !os.IsNotExist(err) {
+		t.Errorf("get() for missing entry got %v, want not exist error", err)
+	}
+	if _, _, err := (sharedBackend{dir: dir, uid: os.Getuid() + 1}).get("a.ENTRY"); err == nil {
+		t.Error("get() for entry of other user = nil error, want error")
+	}
+	if err := os.Chmod(filepath.Join(dir, "a.ENTRY"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := b.get("a.ENTRY"); err == nil {
+		t.Error("get() for world-writable entry = nil error, want error")
+	}
+	if err := b.put("a.ENTRY", nil, time.Now()); err == nil {
+		t.Error("put() = nil, want error")
+	}
+}
+
+func TestCacheCmd_Run_sharedDir(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	if err := os.Chmod(tmpdir, 0777|os.ModeSticky); err != nil {
+		t.Fatal(err)
+	}
+	opt := option{ttl: time.Minute, sharedDir: tmpdir, sharedTrust: defaultSharedTrust, namespace: "proj1"}
+	opt, err := resolveCacheKey(opt, "echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "echo",
+		cmdArgs: []string{"hello"},
+		opt:     opt,
+	}
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	userDir := sharedUserDir(tmpdir, os.Getuid())
+	for _, p := range []string{userDir, filepath.Join(userDir, "proj1"), cachecmd.cacheFilePath() + ".ENTRY"} {
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := fi.Mode().Perm(); perm&0044 != 0044 || perm&0022 != 0 {
+			t.Errorf("%s has mode %v, want readable but not writable by others", p, perm)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+func runShellenv(args []string) (int, error) {
+	fs := flag.NewFlagSet("shellenv", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:	cachecmd shellenv [-shell bash|zsh|fish]")
+		fmt.Fprintln(os.Stderr, "	cachecmd shellenv prints shell functions which wrap commands in \"wrap\" of the config file")
+		fmt.Fprintln(os.Stderr, "	with cachecmd. Add eval \"$(cachecmd shellenv)\" to your shell rc file.")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Flags:")
+		fs.PrintDefaults()
+	}
+	shell := fs.String("shell", "", "shell to print functions for: bash, zsh or fish. (default: $SHELL)")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	if *shell == "" {
+		*shell = filepath.Base(os.Getenv("SHELL"))
+	}
+	cfg, err := loadConfig(configPath())
+	if err != nil {
+		return 1, err
+	}
+	if err := writeShellenv(os.Stdout, *shell, cfg.Wrap); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+var funcNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// writeShellenv writes functions of the shell which wrap commands with
+// cachecmd.
+func writeShellenv(w io.Writer, shell string, wraps []wrapConfig) error {
+	for _, wrap := range wraps {
+		if !funcNameRe.MatchString(wrap.Command) {
+			return fmt.Errorf("invalid command name to wrap: %q", wrap.Command)
+		}
+		flags, err := splitShellWords(wrap.Flags)
+		if err != nil {
+			return fmt.Errorf("invalid flags of %s: %v", wrap.Command, err)
+		}
+		if err := validCommandFlags(flags); err != nil {
+			return fmt.Errorf("invalid flags of %s: %v", wrap.Command, err)
+		}
+		quote := shellQuote
+		if shell == "fish" {
+			quote = fishQuote
+		}
+		args := []string{"command", "cachecmd"}
+		for _, f := range flags {
+			args = append(args, quote(f))
+		}
+		args = append(args, "--", wrap.Command)
+		switch shell {
+		case "bash", "zsh", "sh":
+			fmt.Fprintf(w, "%s() { %s \"$@\"; }\n", wrap.Command, strings.Join(args, " "))
+		case "fish":
+			fmt.Fprintf(w, "function %s; %s $argv; end\n", wrap.Command, strings.Join(args, " "))
+		default:
+			return fmt.Errorf("unsupported shell: %q", shell)
+		}
+	}
+	return nil
+}
+
+// fishQuote quotes s for fish, which escapes quotes and backslashes in single
+// quotes.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteShellenv(t *testing.T) {
+	wraps := []wrapConfig{
+		{Command: "kubectl", Flags: "-ttl=30s -key-env=KUBECONFIG"},
+		{Command: "hub", Flags: `-ttl=10m -filter='grep x'`},
+	}
+	tests := []struct {
+		shell string
+		want  string
+	}{
+		{
+			shell: "bash",
+			want: `kubectl() { command cachecmd '-ttl=30s' '-key-env=KUBECONFIG' -- kubectl "$@"; }
+hub() { command cachecmd '-ttl=10m' '-filter=grep x' -- hub "$@"; }
+`,
+		},
+		{
+			shell: "fish",
+			want: `function kubectl; command cachecmd '-ttl=30s' '-key-env=KUBECONFIG' -- kubectl $argv; end
+function hub; command cachecmd '-ttl=10m' '-filter=grep x' -- hub $argv; end
+`,
+		},
+	}
+	for _, tt := range tests {
+		buf := new(bytes.Buffer)
+		if err := writeShellenv(buf, tt.shell, wraps); err != nil {
+			t.Errorf("%s: got error: %v", tt.shell, err)
+			continue
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.shell, got, tt.want)
+		}
+	}
+}
+
+func TestWriteShellenv_invalid(t *testing.T) {
+	tests := []struct {
+		shell string
+		wrap  wrapConfig
+	}{
+		{shell: "tcsh", wrap: wrapConfig{Command: "kubectl"}},
+		{shell: "bash", wrap: wrapConfig{Command: "rm -rf"}},
+		{shell: "bash", wrap: wrapConfig{Command: "kubectl", Flags: "-unknown"}},
+	}
+	for _, tt := range tests {
+		if err := writeShellenv(new(bytes.Buffer), tt.shell, []wrapConfig{tt.wrap}); err == nil {
+			t.Errorf("%s %+v: got nil error", tt.shell, tt.wrap)
+		}
+	}
+}
+
+func TestFishQuote(t *testing.T) {
+	if got, want := fishQuote(`it's \ ok`), `'it\'s \\ ok'`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+func runShim(args []string) (int, error) {
+	fs := flag.NewFlagSet("shim", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:	cachecmd shim [-dir dir] {command} [cachecmd flags]")
+		fmt.Fprintln(os.Stderr, "	cachecmd shim writes a wrapper of the command which runs it with cachecmd and the given flags.")
+		fmt.Fprintln(os.Stderr, "	Put the shim directory first in PATH to cache the command transparently.")
+		fmt.Fprintln(os.Stderr, "	{env:NAME} in flags is replaced with environment variable NAME when the wrapper runs")
+		fmt.Fprintln(os.Stderr, "	(e.g. cachecmd shim kubectl -ttl=30s -key='{env:KUBECONFIG}').")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Flags:")
+		fs.PrintDefaults()
+	}
+	dir := fs.String("dir", shimDir(), "shim directory.")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2, nil
+	}
+	name, flags := fs.Arg(0), fs.Args()[1:]
+	if err := validCommandFlags(flags); err != nil {
+		return 2, err
+	}
+	path, err := writeShim(*dir, name, flags)
+	if err != nil {
+		return 1, err
+	}
+	fmt.Fprintf(os.Stderr, "cachecmd: wrote %s. Put %s first in PATH.\n", path, *dir)
+	return 0, nil
+}
+
+// shimDir returns the default shim directory in the user data directory.
+func shimDir() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "cachecmd", "shims")
+}
+
+// validCommandFlags returns error if flags are not cachecmd flags without a
+// command.
+func validCommandFlags(flags []string) error {
+	fs := flag.NewFlagSet("cachecmd", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	registerFlags(fs, &option{})
+	if err := fs.Parse(flags); err != nil {
+		return fmt.Errorf("invalid cachecmd flags: %v", err)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("invalid cachecmd flags: unexpected argument %q", fs.Arg(0))
+	}
+	return nil
+}
+
+// writeShim writes the shim of the command to dir and returns its path. The
+// command is resolved in PATH except dir not to run the shim itself.
+func writeShim(dir, name string, flags []string) (string, error) {
+	if strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid command name: %q", name)
+	}
+	command, err := lookPathExcept(name, dir)
+	if err != nil {
+		return "", err
+	}
+	cachecmd, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if runtime.GOOS == "windows" {
+		path += ".cmd"
+	}
+	script := shimScript(runtime.GOOS, cachecmd, command, flags)
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		return "", fmt.Errorf("failed to write shim: %v", err)
+	}
+	return path, nil
+}
+
+// lookPathExcept searches the executable of the given name in PATH except
+// the given directory.
+func lookPathExcept(name, except string) (string, error) {
+	except, _ = filepath.Abs(except)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if abs, _ := filepath.Abs(dir); dir == "" || abs == except {
+			continue
+		}
+		if path, err := exec.LookPath(filepath.Join(dir, name)); err == nil {
+			return filepath.Abs(path)
+		}
+	}
+	return "", fmt.Errorf("%s: %v", name, exec.ErrNotFound)
+}
+
+var shimEnvRe = regexp.MustCompile(`\{env:([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// shimScript returns the content of the shim for goos which runs command with
+// cachecmd and flags.
+func shimScript(goos, cachecmd, command string, flags []string) string {
+	if goos == "windows" {
+		args := []string{cmdQuote(cachecmd)}
+		for _, f := range flags {
+			args = append(args, cmdQuote(shimEnvRe.ReplaceAllString(f, "%$1%")))
+		}
+		args = append(args, "--", cmdQuote(command), "%*")
+		return "@echo off\r\nrem Generated by `cachecmd shim`.\r\n" + strings.Join(args, " ") + "\r\n"
+	}
+	args := []string{"exec", shellQuote(cachecmd)}
+	for _, f := range flags {
+		// Close the quote to expand the variable.
+		args = append(args, shimEnvRe.ReplaceAllString(shellQuote(f), `'"$${$1}"'`))
+	}
+	args = append(args, "--", shellQuote(command), `"$@"`)
+	return "#!/bin/sh\n# Generated by `cachecmd shim`.\n" + strings.Join(args, " ") + "\n"
+}
+
+// shellQuote quotes s for POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// cmdQuote quotes s for cmd.exe.
+func cmdQuote(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestShimScript(t *testing.T) {
+	flags := []string{"-ttl=30s", "-key={env:KUBECONFIG}", "-filter=grep 'x y'"}
+	got := shimScript("windows", `C:\bin\cachecmd.exe`, `C:\bin\kubectl.exe`, flags)
+	want := "@echo off\r\nrem Generated by `cachecmd shim`.\r\n" +
+		`"C:\bin\cachecmd.exe" "-ttl=30s" "-key=%KUBECONFIG%" "-filter=grep 'x y'" -- "C:\bin\kubectl.exe" %*` + "\r\n"
+	if got != want {
+		t.Errorf("windows: got %q, want %q", got, want)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	// Run the shim with echo instead of cachecmd to see arguments.
+	script := shimScript("linux", "/bin/echo", "/usr/bin/kubectl", flags)
+	cmd := exec.Command("sh", "-c", script, "shim", "get", "pods")
+	cmd.Env = append(os.Environ(), "KUBECONFIG=/tmp/kube config")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(out), "-ttl=30s -key=/tmp/kube config -filter=grep 'x y' -- /usr/bin/kubectl get pods\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWriteShim(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shim test uses sh scripts")
+	}
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	bin := filepath.Join(tmpdir, "bin")
+	shims := filepath.Join(tmpdir, "shims")
+	os.MkdirAll(bin, os.ModePerm)
+	if err := ioutil.WriteFile(filepath.Join(bin, "mycmd"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", shims+string(filepath.ListSeparator)+bin)
+
+	for i := 0; i < 2; i++ {
+		// The second shim must not wrap the first shim.
+		path, err := writeShim(shims, "mycmd", []string{"-ttl=1m"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "-- '" + filepath.Join(bin, "mycmd") + "' \"$@\"\n"; !strings.HasSuffix(string(b), want) {
+			t.Errorf("#%d: got %q, want suffix %q", i, b, want)
+		}
+	}
+	if _, err := writeShim(shims, "nonexistent-command", nil); err == nil {
+		t.Error("got nil error for nonexistent command")
+	}
+}
+
+func TestValidShimFlags(t *testing.T) {
+	if err := validCommandFlags([]string{"-ttl=1m", "-async"}); err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	for _, flags := range [][]string{{"-unknown"}, {"-ttl=1m", "cmd"}} {
+		if err := validCommandFlags(flags); err == nil {
+			t.Errorf("validCommandFlags(%q) got nil error", flags)
+		}
+	}
+}
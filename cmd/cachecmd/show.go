@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func runShow(args []string) (int, error) {
+	fs := newSubFlagSet("show", "cachecmd show [flags] {command}",
+		"cachecmd show prints metadata of the cache entry of the command.")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2, nil
+	}
+	opt, err := resolveCacheKey(*flagOpt, fs.Arg(0))
+	if err != nil {
+		return 2, err
+	}
+	c := &CacheCmd{cmdName: fs.Arg(0), cmdArgs: fs.Args()[1:], opt: opt}
+	path := c.cacheFilePath() + ".ENTRY"
+	if !fileexists(path) {
+		return exitCodeNoCache, errNoCache
+	}
+	if err := showEntry(os.Stdout, path, time.Now()); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// showEntry writes metadata of the cache entry of the given path to w. now is
+// used to print age of the entry.
+func showEntry(w io.Writer, path string, now time.Time) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	meta, err := readMeta(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	fmt.Fprintf(w, "path:\t%s\n", path)
+	fmt.Fprintf(w, "command:\t%s\n", entryCommand(meta, filepath.Base(path)))
+	fmt.Fprintf(w, "cached:\t%s (%v ago)\n", stat.ModTime().Format(time.RFC3339),
+		now.Sub(stat.ModTime()).Round(time.Second))
+	fmt.Fprintf(w, "exit:\t%d\n", meta.ExitCode)
+	if meta.Signal != 0 {
+		fmt.Fprintf(w, "signal:\t%d\n", meta.Signal)
+	}
+	fmt.Fprintf(w, "runtime:\t%v (user %v, system %v)\n", meta.Runtime.Round(time.Millisecond),
+		meta.UserTime.Round(time.Millisecond), meta.SystemTime.Round(time.Millisecond))
+	switch {
+	case meta.TTL == ttlNever:
+		fmt.Fprintln(w, "ttl:\tnever")
+	case meta.TTL > 0:
+		fmt.Fprintf(w, "ttl:\t%v\n", meta.TTL)
+	}
+	if meta.TimedOut {
+		fmt.Fprintln(w, "timed out:\ttrue")
+	}
+	return nil
+}
+
+func runCachePath(args []string) (int, error) {
+	fs := newSubFlagSet("cache-path", "cachecmd cache-path [flags] {command}",
+		"cachecmd cache-path prints path of the cache entry file of the command without running it.\n"+
+			"It's the same as `cachecmd -print-cache-path [flags] {command}`.")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	opt := *flagOpt
+	opt.printCachePath = true
+	if err := loadDefaultConfig(&opt); err != nil {
+		return 1, err
+	}
+	return run(os.Stdin, os.Stdout, os.Stderr, opt, fs.Args())
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShowEntry(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "sh",
+		cmdArgs: []string{"-c", "sleep 0.1; exit 2"},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir},
+	}
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	path := cachecmd.cacheFilePath() + ".ENTRY"
+	meta, err := readMeta(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Runtime < 100*time.Millisecond {
+		t.Errorf("got runtime %v in metadata, want >= 100ms", meta.Runtime)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := showEntry(buf, path, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"command:\tsh -c sleep 0.1; exit 2\n",
+		"exit:\t2\n",
+		"runtime:\t",
+		"ttl:\t1m0s\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output does not contain %q: %q", want, buf.String())
+		}
+	}
+}
+
+func TestRun_printCachePath(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	out := filepath.Join(tmpdir, "out")
+	opt := option{ttl: time.Minute, cacheDir: tmpdir, noStdin: true, printCachePath: true}
+	stdout := new(bytes.Buffer)
+	if _, err := run(nil, stdout, ioutil.Discard, opt, []string{"touch", out}); err != nil {
+		t.Fatal(err)
+	}
+	if fileexists(out) {
+		t.Error("command is run with -print-cache-path")
+	}
+	c := CacheCmd{cmdName: "touch", cmdArgs: []string{out}, opt: opt}
+	if got, want := stdout.String(), c.cacheFilePath()+".ENTRY\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// interruptedError is returned when cachecmd is interrupted by a signal while
+// running the command.
+type interruptedError struct {
+	sig os.Signal
+}
+
+func (e *interruptedError) Error() string {
+	return fmt.Sprintf("interrupted by %v", e.sig)
+}
+
+// exitCode returns the exit code of shells for the signal.
+func (e *interruptedError) exitCode() int {
+	if s, ok := e.sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
+
+// exitSignal returns number of the signal which killed the command of err. It
+// returns 0 if the command was not killed by a signal.
+func exitSignal(err error) int {
+	exiterr, ok := err.(*exec.ExitError)
+	if !ok {
+		return 0
+	}
+	if status, ok := exiterr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return int(status.Signal())
+	}
+	return 0
+}
+
+// isTerminal reports whether r is a terminal. Other character devices like
+// /dev/null, which is stdin under cron, are not.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok || f == nil {
+		return false
+	}
+	return isatty(f)
+}
+
+// forwardSignals forwards signals which cachecmd receives to the started
+// process p, or to its process group if group is true, until the returned
+// stop function is called. stop returns the received signal if any and kills
+// the remaining processes in the group after the interruption.
+//
+// If p shares the process group with cachecmd, SIGINT is not forwarded
+// because the terminal sends it to the whole foreground process group.
+func forwardSignals(p *os.Process, group bool) (stop func() os.Signal) {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, forwardedSignals...)
+	done := make(chan struct{})
+	result := make(chan os.Signal, 1)
+	go func() {
+		var received os.Signal
+		defer func() { result <- received }()
+		for {
+			select {
+			case sig := <-sigc:
+				received = sig
+				if group {
+					signalGroup(p, sig)
+				} else if sig != os.Interrupt {
+					p.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() os.Signal {
+		signal.Stop(sigc)
+		close(done)
+		sig := <-result
+		if sig != nil && group {
+			// Do not leave children of the command.
+			signalGroup(p, os.Kill)
+		}
+		return sig
+	}
+}
@@ -0,0 +1,120 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_Run_interrupted(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	started := filepath.Join(tmpdir, "started")
+	orphan := filepath.Join(tmpdir, "orphan")
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "sh",
+		// The background child ignores SIGTERM and must be killed with the group.
+		cmdArgs: []string{"-c", "(trap '' TERM; sleep 1; touch " + orphan + ") & touch " + started + "; wait"},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir},
+	}
+	go func() {
+		for !fileexists(started) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	}()
+	code, err := cachecmd.Run(context.TODO())
+	if _, ok := err.(*interruptedError); !ok {
+		t.Errorf("got error %v, want interruptedError", err)
+	}
+	if want := 128 + int(syscall.SIGTERM); code != want {
+		t.Errorf("got exit code %d, want %d", code, want)
+	}
+	if fileexists(cachecmd.cacheFilePath() + ".ENTRY") {
+		t.Error("result of interrupted command is cached")
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if fileexists(orphan) {
+		t.Error("child of the command is not killed")
+	}
+}
+
+func TestCacheCmd_Run_interruptedRefresh(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	slow := filepath.Join(tmpdir, "slow")
+	started := filepath.Join(tmpdir, "started")
+	stdout := new(bytes.Buffer)
+	cachecmd := CacheCmd{
+		stdout:  stdout,
+		stderr:  ioutil.Discard,
+		cmdName: "sh",
+		cmdArgs: []string{"-c", "if [ -f " + slow + " ]; then touch " + started + "; sleep 5; fi; echo old"},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir},
+	}
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(slow, nil, 0600)
+	go func() {
+		for !fileexists(started) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	}()
+	refresh := cachecmd
+	refresh.opt.refresh = true
+	if _, err := refresh.Run(context.TODO()); err == nil {
+		t.Fatal("got nil error, want interruptedError")
+	}
+	stdout.Reset()
+	if _, err := cachecmd.replayCache(cachecmd.cacheFilePath()); err != nil {
+		t.Fatalf("previous entry is not kept: %v", err)
+	}
+	if got := stdout.String(); got != "old\n" {
+		t.Errorf("got %q, want the previous entry", got)
+	}
+}
+
+func TestCacheCmd_Run_signaled(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "sh",
+		cmdArgs: []string{"-c", "kill -USR1 $$"},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir},
+	}
+	want := 128 + int(syscall.SIGUSR1)
+	for i := 0; i < 2; i++ {
+		cachecmd.signal = 0
+		code, err := cachecmd.Run(context.TODO())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != want {
+			t.Errorf("run %d: got exit code %d, want %d", i, code, want)
+		}
+		if cachecmd.signal != int(syscall.SIGUSR1) {
+			t.Errorf("run %d: got signal %d, want %d", i, cachecmd.signal, syscall.SIGUSR1)
+		}
+	}
+	meta, err := readMeta(cachecmd.cacheFilePath() + ".ENTRY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.ExitCode != want || meta.Signal != int(syscall.SIGUSR1) {
+		t.Errorf("got meta %+v, want exit code %d and signal %d", meta, want, syscall.SIGUSR1)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exitCodeSSHNotFound is the exit code of the remote command of sshBackend
+// if the entry does not exist.
+const exitCodeSSHNotFound = 100
+
+// sshBackend stores entries in a directory of a remote host over SSH. It
+// runs POSIX shell commands on the host, so no server software is needed.
+// Modification time of an entry is read from CachedAt of entry metadata, and
+// it's also stored in `<entry>.MTIME` for entries without it because stat
+// command is not portable. The entry and `<entry>.MTIME` are not replaced
+// atomically together.
+type sshBackend struct {
+	// ssh is the ssh command.
+	ssh  string
+	dest string
+	port string
+	dir  string
+}
+
+// newSSHBackend returns sshBackend of URL like ssh://user@host:port/path.
+func newSSHBackend(rawurl string) (*sshBackend, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Hostname() == "" || u.Path == "" {
+		return nil, fmt.Errorf("invalid -backend: %q", rawurl)
+	}
+	dest := u.Hostname()
+	if u.User != nil {
+		dest = u.User.Username() + "@" + dest
+	}
+	return &sshBackend{ssh: "ssh", dest: dest, port: u.Port(), dir: u.Path}, nil
+}
+
+// command returns ssh command which runs the shell command on the host.
+func (b *sshBackend) command(script string) *exec.Cmd {
+	args := []string{"-o", "BatchMode=yes"}
+	if b.port != "" {
+		args = append(args, "-p", b.port)
+	}
+	args = append(args, b.dest, script)
+	cmd := exec.Command(b.ssh, args...)
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+func (b *sshBackend) get(name string) (io.ReadCloser, time.Time, error) {
+	p := shellQuote(path.Join(b.dir, name))
+	cmd := b.command(fmt.Sprintf("[ -f %s ] || exit %d; cat %s.MTIME 2>/dev/null || echo 0; cat %s",
+		p, exitCodeSSHNotFound, p, p))
+	out, err := cmd.Output()
+	if exiterr, ok := err.(*exec.ExitError); ok && exiterr.ExitCode() == exitCodeSSHNotFound {
+		return nil, time.Time{}, &os.PathError{Op: "get", Path: name, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("ssh failed: %v", err)
+	}
+	r := bufio.NewReader(bytes.NewReader(out))
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid response of ssh: %v", err)
+	}
+	ns, err := strconv.ParseInt(strings.TrimSpace(line), 10, 64)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid modification time: %q", line)
+	}
+	modTime := time.Unix(0, ns)
+	body := out[len(line):]
+	if meta, _, err := readEntryMeta(bytes.NewReader(body), int64(len(body)-checksumTrailerLen)); err == nil && meta.CachedAt != 0 {
+		modTime = time.Unix(0, meta.CachedAt)
+	}
+	return ioutil.NopCloser(bytes.NewReader(body)), modTime, nil
+}
+
+func (b *sshBackend) put(name string, r io.Reader, modTime time.Time) error {
+	p := path.Join(b.dir, name)
+	// Suffix the temp file with PID of the remote shell so that concurrent
+	// puts of the entry from other machines do not write the same file.
+	tmp := shellQuote(path.Join(path.Dir(p), ".tmp_cachecmd_"+path.Base(p)))
+	cmd := b.command(fmt.Sprintf(`set -e; mkdir -p %s; t=%s_$$; trap 'rm -f "$t" "$t.MTIME"' EXIT; `+
+		`cat > "$t"; echo %d > "$t.MTIME"; mv "$t" %s; mv "$t.MTIME" %s.MTIME`,
+		shellQuote(path.Dir(p)), tmp, modTime.UnixNano(), shellQuote(p), shellQuote(p)))
+	cmd.Stdin = r
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ssh failed: %v", err)
+	}
+	return nil
+}
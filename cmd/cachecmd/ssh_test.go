@@ -0,0 +1,156 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewSSHBackend(t *testing.T) {
+	b, err := newSSHBackend("ssh://user@example.com:2222/var/cache/cachecmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &sshBackend{ssh: "ssh", dest: "user@example.com", port: "2222", dir: "/var/cache/cachecmd"}
+	if !reflect.DeepEqual(b, want) {
+		t.Errorf("got %+v, want %+v", b, want)
+	}
+	for _, url := range []string{"ssh://example.com", "ssh:///path"} {
+		if _, err := newSSHBackend(url); err == nil {
+			t.Errorf("newSSHBackend(%q) got nil error", url)
+		}
+	}
+}
+
+func TestSSHBackend_lease(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	fakeSSH := filepath.Join(tmpdir, "ssh")
+	script := "#!/bin/sh\nwhile [ $# -gt 1 ]; do shift; done\nexec sh -c \"$1\"\n"
+	if err := ioutil.WriteFile(fakeSSH, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	testLeaser(t, &sshBackend{ssh: fakeSSH, dest: "host", dir: filepath.Join(tmpdir, "remote dir")})
+}
+
+func TestSSHBackend(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	// Fake ssh runs the remote command locally.
+	fakeSSH := filepath.Join(tmpdir, "ssh")
+	script := "#!/bin/sh\nwhile [ $# -gt 1 ]; do shift; done\nexec sh -c \"$1\"\n"
+	if err := ioutil.WriteFile(fakeSSH, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	b := &sshBackend{ssh: fakeSSH, dest: "host", dir: filepath.Join(tmpdir, "remote dir")}
+
+	if _, _, err := b.get("ns/a.ENTRY"); !os.IsNotExist(err) {
+		t.Errorf("got %v, want not exist error", err)
+	}
+	modTime := time.Unix(1500000000, 123)
+	if err := b.put("ns/a.ENTRY", bytes.NewReader([]byte("entry\nwith newline")), modTime); err != nil {
+		t.Fatal(err)
+	}
+	r, gotTime, err := b.get("ns/a.ENTRY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got, _ := ioutil.ReadAll(r); string(got) != "entry\nwith newline" {
+		t.Errorf("got %q", got)
+	}
+	if !gotTime.Equal(modTime) {
+		t.Errorf("got modification time %v, want %v", gotTime, modTime)
+	}
+}
+
+func TestSSHBackend_cachedAt(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	fakeSSH := filepath.Join(tmpdir, "ssh")
+	script := "#!/bin/sh\nwhile [ $# -gt 1 ]; do shift; done\nexec sh -c \"$1\"\n"
+	if err := ioutil.WriteFile(fakeSSH, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	b := &sshBackend{ssh: fakeSSH, dest: "host", dir: filepath.Join(tmpdir, "remote")}
+
+	c := &CacheCmd{stdout: ioutil.Discard, stderr: ioutil.Discard, cmdName: "echo", cmdArgs: []string{"a"},
+		opt: option{ttl: time.Minute, cacheDir: filepath.Join(tmpdir, "local")}}
+	if _, err := c.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := ioutil.ReadFile(c.cacheFilePath() + ".ENTRY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := readMeta(c.cacheFilePath() + ".ENTRY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// .MTIME of the previous entry may be read with the new entry.
+	if err := b.put("a.ENTRY", bytes.NewReader(entry), time.Unix(1500000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	r, gotTime, err := b.get("a.ENTRY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got, _ := ioutil.ReadAll(r); !bytes.Equal(got, entry) {
+		t.Errorf("got %q, want %q", got, entry)
+	}
+	if want := time.Unix(0, meta.CachedAt); !gotTime.Equal(want) {
+		t.Errorf("got modification time %v, want %v", gotTime, want)
+	}
+}
+
+func TestSSHBackend_put_concurrent(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	fakeSSH := filepath.Join(tmpdir, "ssh")
+	script := "#!/bin/sh\nwhile [ $# -gt 1 ]; do shift; done\nexec sh -c \"$1\"\n"
+	if err := ioutil.WriteFile(fakeSSH, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	b := &sshBackend{ssh: fakeSSH, dest: "host", dir: filepath.Join(tmpdir, "remote")}
+
+	// Puts of the entry from multiple machines.
+	contents := make([][]byte, 4)
+	var wg sync.WaitGroup
+	for i := range contents {
+		contents[i] = bytes.Repeat([]byte{byte('a' + i)}, 1<<20)
+		wg.Add(1)
+		go func(content []byte) {
+			defer wg.Done()
+			if err := b.put("a.ENTRY", bytes.NewReader(content), time.Now()); err != nil {
+				t.Error(err)
+			}
+		}(contents[i])
+	}
+	wg.Wait()
+	r, _, err := b.get("a.ENTRY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, _ := ioutil.ReadAll(r)
+	found := false
+	for _, content := range contents {
+		found = found || bytes.Equal(got, content)
+	}
+	if !found {
+		t.Errorf("got broken entry of %d bytes", len(got))
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(tmpdir, "remote", ".tmp_cachecmd_*")); len(tmps) > 0 {
+		t.Errorf("temp files are left: %q", tmps)
+	}
+}
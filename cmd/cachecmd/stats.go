@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func runStats(args []string) (int, error) {
+	fs := newSubFlagSet("stats", "cachecmd stats [-json | -csv | -openmetrics] [flags]",
+		"cachecmd stats prints statistics of cache entries in the cache directory or namespace:\n"+
+			"the number of hits and misses, hit rate and runtime saved by cache, per entry and in total.")
+	jsonOut := fs.Bool("json", false, "print statistics per entry and in total as JSON.")
+	csvOut := fs.Bool("csv", false, `print statistics as CSV with a header. The first column is "entry" for entries or "total" for the last row of totals.`)
+	openMetrics := fs.Bool("openmetrics", false,
+		"print statistics in OpenMetrics text format for the textfile collector of node_exporter. All metrics are gauges since removed entries are not counted.")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	dir, err := optionCacheDir(*flagOpt)
+	if err != nil {
+		return 2, err
+	}
+	formats := 0
+	for _, b := range []bool{*jsonOut, *csvOut, *openMetrics} {
+		if b {
+			formats++
+		}
+	}
+	if formats > 1 {
+		return 2, errors.New("only one of -json, -csv and -openmetrics can be used")
+	}
+	s, err := collectStats(dir)
+	if err != nil {
+		return 1, err
+	}
+	switch {
+	case *jsonOut:
+		err = writeStatsJSON(os.Stdout, s)
+	case *csvOut:
+		err = writeStatsCSV(os.Stdout, s)
+	case *openMetrics:
+		err = writeStatsOpenMetrics(os.Stdout, s)
+	default:
+		writeStatsText(os.Stdout, s)
+	}
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// entryStats is statistics of a cache entry. Fields of metadata are zero for
+// broken entries.
+type entryStats struct {
+	Path     string  `json:"path"`
+	Command  string  `json:"command"`
+	CachedAt int64   `json:"cached_at"`
+	ExitCode int     `json:"exit_code"`
+	Size     int64   `json:"size"`
+	Hits     int     `json:"hits"`
+	Misses   int     `json:"misses"`
+	HitRate  float64 `json:"hit_rate"`
+	LastHit  int64   `json:"last_hit,omitempty"`
+	Runtime  float64 `json:"runtime_seconds"`
+	Saved    float64 `json:"saved_seconds"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// totalStats is statistics of all entries.
+type totalStats struct {
+	Entries int     `json:"entries"`
+	Size    int64   `json:"size"`
+	Hits    int     `json:"hits"`
+	Misses  int     `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+	Saved   float64 `json:"saved_seconds"`
+}
+
+type cacheStats struct {
+	Entries []entryStats `json:"entries"`
+	Total   totalStats   `json:"total"`
+}
+
+// hitRate returns the ratio of hits to all uses, or 0 if it's not used.
+func hitRate(hits, misses int) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// collectStats returns statistics of cache entries in dir. Runtime saved by
+// an entry is estimated as the runtime of the command times the hits.
+func collectStats(dir string) (cacheStats, error) {
+	s := cacheStats{Entries: []entryStats{}}
+	err := walkEntries(dir, func(path string, fi os.FileInfo, meta entryMeta, err error) {
+		a := readAccess(strings.TrimSuffix(path, ".ENTRY"))
+		e := entryStats{
+			Path:     path,
+			Command:  entryCommand(meta, fi.Name()),
+			CachedAt: fi.ModTime().Unix(),
+			Size:     fi.Size(),
+			Hits:     a.hits,
+			Misses:   a.misses,
+			HitRate:  hitRate(a.hits, a.misses),
+		}
+		if !a.lastHit.IsZero() {
+			e.LastHit = a.lastHit.Unix()
+		}
+		if err != nil {
+			e.Error = err.Error()
+		} else {
+			e.ExitCode = meta.ExitCode
+			e.Runtime = meta.Runtime.Seconds()
+			e.Saved = (meta.Runtime * time.Duration(a.hits)).Seconds()
+		}
+		s.Entries = append(s.Entries, e)
+		s.Total.Entries++
+		s.Total.Size += e.Size
+		s.Total.Hits += e.Hits
+		s.Total.Misses += e.Misses
+		s.Total.Saved += e.Saved
+	})
+	s.Total.HitRate = hitRate(s.Total.Hits, s.Total.Misses)
+	return s, err
+}
+
+func writeStatsJSON(w io.Writer, s cacheStats) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+func writeStatsCSV(w io.Writer, s cacheStats) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"type", "path", "command", "cached_at", "exit_code", "size", "hits", "misses", "hit_rate",
+		"last_hit", "runtime_seconds", "saved_seconds", "error"})
+	for _, e := range s.Entries {
+		lastHit := ""
+		if e.LastHit != 0 {
+			lastHit = strconv.FormatInt(e.LastHit, 10)
+		}
+		exitCode, runtime := "", ""
+		if e.Error == "" {
+			exitCode, runtime = strconv.Itoa(e.ExitCode), formatFloat(e.Runtime)
+		}
+		cw.Write([]string{"entry", e.Path, e.Command, strconv.FormatInt(e.CachedAt, 10), exitCode,
+			strconv.FormatInt(e.Size, 10), strconv.Itoa(e.Hits), strconv.Itoa(e.Misses), formatFloat(e.HitRate),
+			lastHit, runtime, formatFloat(e.Saved), e.Error})
+	}
+	t := s.Total
+	cw.Write([]string{"total", "", "", "", "", strconv.FormatInt(t.Size, 10), strconv.Itoa(t.Hits),
+		strconv.Itoa(t.Misses), formatFloat(t.HitRate), "", "", formatFloat(t.Saved), ""})
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeStatsText(w io.Writer, s cacheStats) {
+	t := s.Total
+	fmt.Fprintf(w, "entries:\t%d\n", t.Entries)
+	fmt.Fprintf(w, "size:\t%d\n", t.Size)
+	fmt.Fprintf(w, "hits:\t%d\n", t.Hits)
+	fmt.Fprintf(w, "misses:\t%d\n", t.Misses)
+	fmt.Fprintf(w, "hit rate:\t%.1f%%\n", t.HitRate*100)
+	fmt.Fprintf(w, "saved:\t%v\n", time.Duration(t.Saved*float64(time.Second)).Round(time.Millisecond))
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
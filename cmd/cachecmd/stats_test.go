@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectStats(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "echo",
+		cmdArgs: []string{"hello"},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir},
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpdir, "v4-broken.ENTRY"), []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := collectStats(tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(s.Entries))
+	}
+	for _, e := range s.Entries {
+		if e.Command == "echo hello" {
+			if e.Hits != 3 || e.Misses != 1 || e.HitRate != 0.75 || e.LastHit == 0 {
+				t.Errorf("got %+v, want 3 hits and 1 miss", e)
+			}
+		} else if e.Error == "" {
+			t.Errorf("broken entry has no error: %+v", e)
+		}
+	}
+	want := totalStats{Entries: 2, Size: s.Entries[0].Size + s.Entries[1].Size, Hits: 3, Misses: 1, HitRate: 0.75,
+		Saved: s.Entries[0].Saved + s.Entries[1].Saved}
+	if s.Total != want {
+		t.Errorf("got total %+v, want %+v", s.Total, want)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := writeStatsJSON(buf, s); err != nil {
+		t.Fatal(err)
+	}
+	var got cacheStats
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Total != s.Total || len(got.Entries) != 2 {
+		t.Errorf("got %+v from JSON, want %+v", got, s)
+	}
+
+	buf.Reset()
+	if err := writeStatsCSV(buf, s); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[0][0] != "type" || records[3][0] != "total" {
+		t.Fatalf("got %q, want header, 2 entries and total", records)
+	}
+	if total := strings.Join(records[3][6:9], ","); total != "3,1,0.75" {
+		t.Errorf("got hits, misses and hit rate %q in total", total)
+	}
+}
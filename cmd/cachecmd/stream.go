@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Stream IDs of chunks in output stream of cache entry.
+const (
+	streamStdout byte = 1
+	streamStderr byte = 2
+	// streamTiming is a chunk of 8 bytes big endian nanoseconds since the
+	// command started, which is the time of the following chunks.
+	streamTiming byte = 3
+)
+
+// timingResolution is the minimum interval of timing chunks. Output of fast
+// commands has no timing chunks.
+const timingResolution = 10 * time.Millisecond
+
+// streamWriter writes output of the command to cache entry as framed
+// chunks tagged by stream, so that stdout and stderr are replayed in the
+// original order. Each chunk is a stream ID byte, 4 bytes big endian length
+// and data.
+type streamWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+	// start is when the command started if timing is recorded and last is the
+	// last recorded time since start.
+	start time.Time
+	last  time.Duration
+}
+
+func newStreamWriter(w io.Writer) *streamWriter {
+	return &streamWriter{w: w}
+}
+
+// recordTiming makes s record time of chunks since start for -replay-timing.
+func (s *streamWriter) recordTiming(start time.Time) {
+	s.start = start
+}
+
+// writer returns io.Writer which writes chunks of the given stream.
+func (s *streamWriter) writer(stream byte) io.Writer {
+	return &chunkWriter{s: s, stream: stream}
+}
+
+type chunkWriter struct {
+	s      *streamWriter
+	stream byte
+}
+
+func (cw *chunkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	var header [5]byte
+	header[0] = cw.stream
+	binary.BigEndian.PutUint32(header[1:], uint32(len(p)))
+	cw.s.mu.Lock()
+	defer cw.s.mu.Unlock()
+	if err := cw.s.writeTiming(); err != nil {
+		return 0, err
+	}
+	if _, err := cw.s.w.Write(header[:]); err != nil {
+		return 0, err
+	}
+	return cw.s.w.Write(p)
+}
+
+// writeTiming writes timing chunk if the time has advanced since the last one.
+// s.mu must be held.
+func (s *streamWriter) writeTiming() error {
+	if s.start.IsZero() {
+		return nil
+	}
+	elapsed := time.Since(s.start)
+	if elapsed-s.last < timingResolution {
+		return nil
+	}
+	s.last = elapsed
+	var chunk [13]byte
+	chunk[0] = streamTiming
+	binary.BigEndian.PutUint32(chunk[1:], 8)
+	binary.BigEndian.PutUint64(chunk[5:], uint64(elapsed))
+	_, err := s.w.Write(chunk[:])
+	return err
+}
+
+// replayStream reads chunks from r and writes them to stdout or stderr.
+func replayStream(r io.Reader, stdout, stderr io.Writer) error {
+	return replayStreamTiming(r, stdout, stderr, false)
+}
+
+// replayStreamTiming is replayStream which waits for the recorded time of
+// chunks since it starts if timing is true.
+func replayStreamTiming(r io.Reader, stdout, stderr io.Writer, timing bool) error {
+	start := time.Now()
+	var header [5]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("broken cache: %v", err)
+		}
+		var w io.Writer
+		switch header[0] {
+		case streamStdout:
+			w = stdout
+		case streamStderr:
+			w = stderr
+		case streamTiming:
+			var t [8]byte
+			if binary.BigEndian.Uint32(header[1:]) != 8 {
+				return fmt.Errorf("broken cache: invalid timing chunk")
+			}
+			if _, err := io.ReadFull(r, t[:]); err != nil {
+				return fmt.Errorf("broken cache: %v", err)
+			}
+			if timing {
+				time.Sleep(time.Until(start.Add(time.Duration(binary.BigEndian.Uint64(t[:])))))
+			}
+			continue
+		default:
+			return fmt.Errorf("broken cache: unknown stream %d", header[0])
+		}
+		n := int64(binary.BigEndian.Uint32(header[1:]))
+		if _, err := io.CopyN(w, r, n); err != nil {
+			return fmt.Errorf("broken cache: %v", err)
+		}
+	}
+}
+
+// limitWriter writes data to w until the total size exceeds max. Data after
+// that is discarded without error so that output is still displayed. max <= 0
+// means no limit.
+type limitWriter struct {
+	w        io.Writer
+	max      int64
+	n        int64
+	exceeded bool
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	lw.n += int64(len(p))
+	if lw.max > 0 && lw.n > lw.max {
+		lw.exceeded = true
+	}
+	if lw.exceeded {
+		return len(p), nil
+	}
+	return lw.w.Write(p)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestStreamWriter_replayStream(t *testing.T) {
+	buf := new(bytes.Buffer)
+	sw := newStreamWriter(buf)
+	stdout, stderr := sw.writer(streamStdout), sw.writer(streamStderr)
+	io.WriteString(stdout, "out1\n")
+	io.WriteString(stderr, "err1\n")
+	io.WriteString(stdout, "out2\n")
+
+	var combined bytes.Buffer
+	gotOut := &orderWriter{prefix: "1:", w: &combined}
+	gotErr := &orderWriter{prefix: "2:", w: &combined}
+	if err := replayStream(bytes.NewReader(buf.Bytes()), gotOut, gotErr); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := combined.String(), "1:out1\n2:err1\n1:out2\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if err := replayStream(bytes.NewReader(buf.Bytes()[:buf.Len()-1]), gotOut, gotErr); err == nil {
+		t.Error("got nil error for truncated stream")
+	}
+}
+
+type orderWriter struct {
+	prefix string
+	w      io.Writer
+}
+
+func (o *orderWriter) Write(p []byte) (int, error) {
+	io.WriteString(o.w, o.prefix)
+	return o.w.Write(p)
+}
+
+func TestStreamWriter_replayStreamTiming(t *testing.T) {
+	buf := new(bytes.Buffer)
+	sw := newStreamWriter(buf)
+	sw.recordTiming(time.Now())
+	stdout := sw.writer(streamStdout)
+	io.WriteString(stdout, "out1\n")
+	time.Sleep(100 * time.Millisecond)
+	io.WriteString(stdout, "out2\n")
+	if !bytes.Contains(buf.Bytes(), []byte{streamTiming}) {
+		t.Fatalf("timing is not recorded: %q", buf.Bytes())
+	}
+
+	for _, timing := range []bool{false, true} {
+		got := new(bytes.Buffer)
+		start := time.Now()
+		if err := replayStreamTiming(bytes.NewReader(buf.Bytes()), got, ioutil.Discard, timing); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != "out1\nout2\n" {
+			t.Errorf("timing=%v: got %q, want %q", timing, got.String(), "out1\nout2\n")
+		}
+		if elapsed := time.Since(start); timing != (elapsed >= 90*time.Millisecond) {
+			t.Errorf("timing=%v: replay took %v", timing, elapsed)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+)
+
+// tailSeparator is printed between cached output and fresh output with -tail.
+const tailSeparator = "--- cachecmd: updated ---"
+
+// tailRefresh updates cache of the given base path in foreground after the
+// cached output is printed with -tail, and prints fresh output (or diff of
+// stdout with -tail-diff) after the separator. If other process is updating
+// the cache, it waits for the process and prints its result instead. It
+// returns the exit code of fresh result.
+func (c *CacheCmd) tailRefresh(ctx context.Context, base string, code int) (int, error) {
+	cached := new(bytes.Buffer)
+	if c.opt.tailDiff {
+		replay := *c
+		replay.stdout, replay.stderr = cached, ioutil.Discard
+		replay.opt.replayTiming = false
+		if _, err := replay.replayCache(base); err != nil {
+			return code, err
+		}
+	}
+
+	fresh, freshErr := new(bytes.Buffer), new(bytes.Buffer)
+	update := *c
+	update.stdout, update.stderr = fresh, freshErr
+	update.opt.replayTiming = false
+	if isLocked(base+".LOCK", c.opt.lockMode) {
+		if !waitUnlock(base+".LOCK", c.opt.lockMode, c.opt.inflightTimeout) {
+			return code, nil
+		}
+		var err error
+		if code, err = update.replayCache(base); err != nil {
+			return code, err
+		}
+	} else {
+		update.opt.refresh = true
+		update.opt.trigger = triggerHit
+		var err error
+		if code, err = update.fromCacheOrRun(ctx); err != nil {
+			return code, err
+		}
+	}
+
+	if c.opt.tailDiff {
+		var diff bytes.Buffer
+		changed, err := writeOutputDiff(&diff, cached, fresh, c.opt.normalize)
+		if err != nil {
+			return code, err
+		}
+		if !changed {
+			fmt.Fprintln(c.stdout, "--- cachecmd: unchanged ---")
+			return code, nil
+		}
+		fresh, freshErr = &diff, new(bytes.Buffer)
+	}
+	fmt.Fprintln(c.stdout, tailSeparator)
+	if _, err := c.stdout.Write(fresh.Bytes()); err != nil {
+		return code, err
+	}
+	if !c.opt.noStderr {
+		c.stderr.Write(freshErr.Bytes())
+	}
+	return code, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_Run_tail(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	cachecmd := CacheCmd{
+		stderr:  ioutil.Discard,
+		cmdName: "date",
+		cmdArgs: []string{`+%N`},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir, async: true, tail: true},
+	}
+	stdout1 := new(bytes.Buffer)
+	cachecmd.stdout = stdout1
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout2 := new(bytes.Buffer)
+	cachecmd.stdout = stdout2
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.SplitN(stdout2.String(), tailSeparator+"\n", 2)
+	if len(parts) != 2 {
+		t.Fatalf("output %q does not have the separator", stdout2.String())
+	}
+	if parts[0] != stdout1.String() {
+		t.Errorf("output before separator = %q, want cached output %q", parts[0], stdout1.String())
+	}
+	if parts[1] == stdout1.String() {
+		t.Errorf("output after separator = %q, want fresh output", parts[1])
+	}
+
+	stdout3 := new(bytes.Buffer)
+	cachecmd.stdout = stdout3
+	if _, err := cachecmd.replayCache(cachecmd.cacheFilePath()); err != nil {
+		t.Fatal(err)
+	}
+	if got := stdout3.String(); got != parts[1] {
+		t.Errorf("cache = %q, want fresh output %q", got, parts[1])
+	}
+}
+
+func TestCacheCmd_Run_tailDiff(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	cachecmd := CacheCmd{
+		stderr:  ioutil.Discard,
+		cmdName: "echo",
+		cmdArgs: []string{"hello"},
+		opt:     option{ttl: time.Minute, cacheDir: tmpdir, async: true, tail: true, tailDiff: true},
+	}
+	cachecmd.stdout = ioutil.Discard
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := new(bytes.Buffer)
+	cachecmd.stdout = stdout
+	if _, err := cachecmd.Run(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stdout.String(), "hello\n--- cachecmd: unchanged ---\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
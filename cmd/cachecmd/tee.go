@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// atomicFile is a file which is written to a temp file and renamed to path on
+// commit, so that readers never see partially written file.
+type atomicFile struct {
+	*os.File
+	path string
+	// sync is whether to fsync the file before rename, which is needed on
+	// network file systems not to expose partially written file to other hosts.
+	sync bool
+	// durable is whether to fsync the directory after rename too.
+	durable bool
+}
+
+// createAtomicFile creates atomicFile of path with permission perm. If perm is
+// 0, the file keeps permission of the existing file at path, or it's created
+// with 0666 masked by umask as shell redirection does. With fsync, the file
+// and the directory are synced on commit so that it survives power loss.
+func createAtomicFile(path string, perm os.FileMode, fsync bool) (*atomicFile, error) {
+	f, err := createTempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %v", err)
+	}
+	if fi, errStat := os.Stat(path); perm == 0 && errStat == nil {
+		perm = fi.Mode().Perm()
+	}
+	if perm != 0 {
+		if err := f.Chmod(perm); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return nil, err
+		}
+	}
+	return &atomicFile{File: f, path: path, sync: fsync || isNetworkFS(filepath.Dir(path)), durable: fsync}, nil
+}
+
+// createTempFile creates a new file in dir like ioutil.TempFile, but with 0666
+// masked by umask instead of 0600.
+func createTempFile(dir, prefix string) (*os.File, error) {
+	for i := 0; i < 10000; i++ {
+		name := filepath.Join(dir, prefix+strconv.Itoa(os.Getpid())+"_"+strconv.FormatInt(time.Now().UnixNano()+int64(i), 36))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, err
+	}
+	return nil, &os.PathError{Op: "createtemp", Path: filepath.Join(dir, prefix+"*"), Err: os.ErrExist}
+}
+
+// commit closes the file and renames it to path.
+func (f *atomicFile) commit() error {
+	if f.sync {
+		if err := f.Sync(); err != nil {
+			f.abort()
+			return fmt.Errorf("failed to sync: %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to rename: %v", err)
+	}
+	if f.durable {
+		if err := syncDir(filepath.Dir(f.path)); err != nil {
+			return fmt.Errorf("failed to sync directory: %v", err)
+		}
+	}
+	return nil
+}
+
+// abort closes and removes the file without updating path.
+func (f *atomicFile) abort() {
+	f.Close()
+	os.Remove(f.Name())
+}
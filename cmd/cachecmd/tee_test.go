@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_Run_teeFile(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	tee := filepath.Join(tmpdir, "out.txt")
+	for i := 0; i < 2; i++ {
+		os.Remove(tee)
+		cachecmd := CacheCmd{
+			stdout:  ioutil.Discard,
+			stderr:  ioutil.Discard,
+			cmdName: "echo",
+			cmdArgs: []string{"hello"},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir, teeFile: tee},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(tee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(b); got != "hello\n" {
+			t.Errorf("#%d: got %q, want %q", i, got, "hello\n")
+		}
+	}
+
+	// Keep the file if cachecmd fails.
+	cachecmd := CacheCmd{
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "echo",
+		cmdArgs: []string{"other"},
+		opt:     option{cacheDir: tmpdir, teeFile: tee, onlyCached: true},
+	}
+	if _, err := cachecmd.Run(context.TODO()); err != errNoCache {
+		t.Fatalf("got %v, want errNoCache", err)
+	}
+	if b, _ := ioutil.ReadFile(tee); string(b) != "hello\n" {
+		t.Errorf("got %q after failure, want %q", b, "hello\n")
+	}
+	files, _ := filepath.Glob(filepath.Join(tmpdir, ".out.txt.tmp*"))
+	if len(files) != 0 {
+		t.Errorf("temp files are not removed: %v", files)
+	}
+}
+
+func TestCacheCmd_Run_outputFile(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	out := filepath.Join(tmpdir, "out.txt")
+	for i := 0; i < 2; i++ {
+		os.Remove(out)
+		stdout := new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  stdout,
+			stderr:  ioutil.Discard,
+			cmdName: "echo",
+			cmdArgs: []string{"hello"},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir, outputFile: out},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := ioutil.ReadFile(out); string(b) != "hello\n" {
+			t.Errorf("#%d: got %q, want %q", i, b, "hello\n")
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("#%d: got stdout %q, want nothing with -o", i, stdout.String())
+		}
+	}
+}
+
+func TestCacheCmd_Run_fsync(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	out := filepath.Join(tmpdir, "out.txt")
+	for i := 0; i < 2; i++ {
+		stdout := new(bytes.Buffer)
+		cachecmd := CacheCmd{
+			stdout:  stdout,
+			stderr:  ioutil.Discard,
+			cmdName: "echo",
+			cmdArgs: []string{"hello"},
+			opt:     option{ttl: time.Minute, cacheDir: tmpdir, teeFile: out, fsync: true},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := ioutil.ReadFile(out); string(b) != "hello\n" || stdout.String() != "hello\n" {
+			t.Errorf("#%d: got %q and %q in -tee-file, want %q", i, stdout.String(), b, "hello\n")
+		}
+		if i == 1 && cachecmd.status != statusHit {
+			t.Errorf("got status %q, want %q", cachecmd.status, statusHit)
+		}
+	}
+}
+
+func TestCreateAtomicFile_mode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission is not supported on Windows")
+	}
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	// Mode of files created by shell redirection.
+	probe := filepath.Join(tmpdir, "probe")
+	ioutil.WriteFile(probe, nil, 0666)
+	fi, _ := os.Stat(probe)
+	umasked := fi.Mode().Perm()
+
+	path := filepath.Join(tmpdir, "out.txt")
+	commit := func(perm os.FileMode) os.FileMode {
+		t.Helper()
+		f, err := createAtomicFile(path, perm, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.commit(); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Mode().Perm()
+	}
+	if got := commit(0); got != umasked {
+		t.Errorf("new file has mode %#o, want %#o", got, umasked)
+	}
+	os.Chmod(path, 0604)
+	if got := commit(0); got != 0604 {
+		t.Errorf("got mode %#o, want mode of the existing file 0604", got)
+	}
+	if got := commit(0600); got != 0600 {
+		t.Errorf("got mode %#o, want 0600", got)
+	}
+}
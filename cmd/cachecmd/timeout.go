@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// exitCodeTimeout is the exit code when the command times out, which is the
+// same as timeout(1).
+const exitCodeTimeout = 124
+
+// timeoutError is returned when the command is killed by -timeout.
+type timeoutError struct {
+	timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("command timed out after %v", e.timeout)
+}
+
+// startTimeout kills p, or its process group if group is true, after timeout.
+// The returned stop function reports whether p is killed.
+func startTimeout(p *os.Process, group bool, timeout time.Duration) (stop func() bool) {
+	if timeout <= 0 {
+		return func() bool { return false }
+	}
+	var killed int32
+	timer := time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&killed, 1)
+		if group {
+			signalGroup(p, os.Kill)
+		} else {
+			p.Kill()
+		}
+	})
+	return func() bool {
+		timer.Stop()
+		return atomic.LoadInt32(&killed) == 1
+	}
+}
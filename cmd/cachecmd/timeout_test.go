@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCacheCmd_Run_timeout(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	state := filepath.Join(tmpdir, "state")
+	tests := []struct {
+		script         string
+		staleOnTimeout bool
+		wantCode       int
+		wantStdout     string
+	}{
+		{script: "echo first", wantCode: 0, wantStdout: "first\n"},
+		{script: "echo second; sleep 10", staleOnTimeout: true, wantCode: exitCodeTimeout, wantStdout: "first\n"},
+		{script: "echo third; sleep 10", wantCode: exitCodeTimeout, wantStdout: "third\n"},
+	}
+	for i, tt := range tests {
+		if err := ioutil.WriteFile(state, []byte(tt.script), 0600); err != nil {
+			t.Fatal(err)
+		}
+		cachecmd := CacheCmd{
+			stdout:  ioutil.Discard,
+			stderr:  ioutil.Discard,
+			cmdName: "sh",
+			cmdArgs: []string{state},
+			opt: option{ttl: 0, cacheDir: tmpdir, timeout: 200 * time.Millisecond,
+				staleOnTimeout: tt.staleOnTimeout},
+		}
+		start := time.Now()
+		code, err := cachecmd.Run(context.TODO())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.wantCode {
+			t.Errorf("#%d: got exit code %d, want %d", i, code, tt.wantCode)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("#%d: command is not killed: %v", i, elapsed)
+		}
+
+		stdout := new(bytes.Buffer)
+		cachecmd.stdout = stdout
+		cachecmd.opt.onlyCached = true
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got := stdout.String(); got != tt.wantStdout {
+			t.Errorf("#%d: got cached stdout %q, want %q", i, got, tt.wantStdout)
+		}
+	}
+	meta, err := readMeta(filepath.Join(tmpdir, (&CacheCmd{cmdName: "sh", cmdArgs: []string{state}}).cacheFileName()+".ENTRY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.TimedOut {
+		t.Error("timeout is not recorded in metadata")
+	}
+}
+
+func TestCacheCmd_Run_timeout_devNull(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process groups are not used on windows")
+	}
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	// /dev/null is stdin under cron. It's a character device but not a
+	// terminal, so the grandchild is killed with the process group.
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	cachecmd := CacheCmd{
+		stdin:   devNull,
+		stdout:  ioutil.Discard,
+		stderr:  ioutil.Discard,
+		cmdName: "sh",
+		cmdArgs: []string{"-c", "sleep 10; echo x"},
+		opt:     option{ttl: 0, cacheDir: tmpdir, timeout: 200 * time.Millisecond},
+	}
+	start := time.Now()
+	code, err := cachecmd.Run(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != exitCodeTimeout {
+		t.Errorf("got exit code %d, want %d", code, exitCodeTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("grandchild is not killed: %v", elapsed)
+	}
+}
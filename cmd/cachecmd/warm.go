@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+func runWarm(args []string) (int, error) {
+	fs := newSubFlagSet("warm", "cachecmd warm [-f file] [-j jobs] [flags]",
+		"cachecmd warm runs commands listed in the file and caches the results.\n"+
+			"Each line is cachecmd flags and a command (e.g. -ttl=1h -key-cwd go list ./...).\n"+
+			"Flags given to warm are default flags of each line.")
+	file := fs.String("f", "", "file of command list. (default: stdin)")
+	jobs := fs.Int("j", runtime.NumCPU(), "number of commands to run concurrently.")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	if err := loadDefaultConfig(flagOpt); err != nil {
+		return 1, err
+	}
+
+	r := io.Reader(os.Stdin)
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return 1, err
+		}
+		defer f.Close()
+		r = f
+	}
+	entries, err := parseWarmList(r, *flagOpt)
+	if err != nil {
+		return 2, err
+	}
+	if failed := warm(os.Stderr, entries, *jobs); failed > 0 {
+		return 1, fmt.Errorf("failed to warm %d of %d commands", failed, len(entries))
+	}
+	return 0, nil
+}
+
+// commandEntry is a command line in a command list, which consists of
+// cachecmd flags and a command.
+type commandEntry struct {
+	line    string
+	opt     option
+	command []string
+}
+
+// parseWarmList parses list of commands to warm cache. Empty lines and lines
+// starting with # are ignored. opt is default option of each line.
+func parseWarmList(r io.Reader, opt option) ([]commandEntry, error) {
+	var entries []commandEntry
+	s := bufio.NewScanner(r)
+	for lnum := 1; s.Scan(); lnum++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e, err := parseCommandEntry(line, opt)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lnum, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, s.Err()
+}
+
+// parseCommandEntry parses a line of cachecmd flags and a command. opt is
+// default option of the line.
+func parseCommandEntry(line string, opt option) (commandEntry, error) {
+	words, err := splitShellWords(line)
+	if err != nil {
+		return commandEntry{}, err
+	}
+	e := commandEntry{line: line, opt: opt}
+	fs := flag.NewFlagSet("cachecmd", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	registerFlags(fs, &e.opt)
+	if err := fs.Parse(words); err != nil {
+		return commandEntry{}, err
+	}
+	if e.command, err = commandArgs(words, fs.Args()); err != nil {
+		return commandEntry{}, err
+	}
+	if len(e.command) == 0 && e.opt.shellString == "" {
+		return commandEntry{}, errors.New("no command")
+	}
+	return e, nil
+}
+
+// warm runs the commands to cache their results if cache is not fresh with
+// at most jobs commands at a time. It reports failures and summary to w and
+// returns the number of failed commands.
+func warm(w io.Writer, entries []commandEntry, jobs int) (failed int) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	errs := make([]error, len(entries))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, e commandEntry) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			code, sig, err := runCommand(nil, ioutil.Discard, ioutil.Discard, e.opt, e.command)
+			if err == nil && sig != 0 {
+				err = fmt.Errorf("killed by signal %d", sig)
+			} else if err == nil && code != 0 {
+				err = fmt.Errorf("exit status %d", code)
+			}
+			errs[i] = err
+		}(i, e)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "cachecmd: warm %q: %v\n", entries[i].line, err)
+		}
+	}
+	fmt.Fprintf(w, "cachecmd: warmed %d commands: %d succeeded, %d failed\n",
+		len(entries), len(entries)-failed, failed)
+	return failed
+}
+
+// splitShellWords splits s into words like shell. It supports single quotes,
+// double quotes and backslash escapes but not expansions.
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
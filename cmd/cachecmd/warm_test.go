@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "go list ./...", want: []string{"go", "list", "./..."}},
+		{in: `sh -c 'date; sleep 1'`, want: []string{"sh", "-c", "date; sleep 1"}},
+		{in: `echo "a \"b\"" c\ d ''`, want: []string{"echo", `a "b"`, "c d", ""}},
+		{in: "  ", want: nil},
+	}
+	for _, tt := range tests {
+		got, err := splitShellWords(tt.in)
+		if err != nil {
+			t.Errorf("splitShellWords(%q) got error: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitShellWords(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if _, err := splitShellWords(`echo 'a`); err == nil {
+		t.Error("got nil error for unterminated quote")
+	}
+}
+
+func TestParseWarmList(t *testing.T) {
+	list := `# comment
+-ttl=1h -key=k go list ./...
+
+date +%N
+`
+	entries, err := parseWarmList(strings.NewReader(list), option{ttl: time.Minute, cacheKey: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if e := entries[0]; e.opt.ttl != time.Hour || e.opt.cacheKey != "k" ||
+		!reflect.DeepEqual(e.command, []string{"go", "list", "./..."}) {
+		t.Errorf("got unexpected first entry: %+v", e)
+	}
+	if e := entries[1]; e.opt.ttl != time.Minute || e.opt.cacheKey != "default" ||
+		!reflect.DeepEqual(e.command, []string{"date", "+%N"}) {
+		t.Errorf("got unexpected second entry: %+v", e)
+	}
+
+	if _, err := parseWarmList(strings.NewReader("-ttl=1h -c 'date | wc'\n-- -weird\n"), option{}); err != nil {
+		t.Errorf("got error for -c and --: %v", err)
+	}
+	if _, err := parseWarmList(strings.NewReader("-ttl=1h\n"), option{}); err == nil {
+		t.Error("got nil error for line without command")
+	}
+}
+
+func TestWarm(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	opt := option{ttl: time.Minute, cacheDir: tmpdir, hash: "sha256"}
+	list := "date +%N\nsh -c 'exit 3'\n"
+	entries, err := parseWarmList(strings.NewReader(list), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if failed := warm(out, entries, 2); failed != 1 {
+		t.Errorf("got %d failures, want 1: %s", failed, out)
+	}
+	if want := "warmed 2 commands: 1 succeeded, 1 failed"; !strings.Contains(out.String(), want) {
+		t.Errorf("got %q, want summary %q", out.String(), want)
+	}
+	c := CacheCmd{cmdName: "date", cmdArgs: []string{"+%N"}, opt: opt}
+	if !fileexists(c.cacheFilePath() + ".ENTRY") {
+		t.Error("cache is not created")
+	}
+}
+
+func TestWarm_concurrent(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	opt := option{ttl: time.Minute, cacheDir: tmpdir}
+	list := "sh -c 'sleep 0.3; echo 1'\nsh -c 'sleep 0.3; echo 2'\nsh -c 'sleep 0.3; echo 3'\n"
+	entries, err := parseWarmList(strings.NewReader(list), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if failed := warm(ioutil.Discard, entries, 3); failed != 0 {
+		t.Errorf("got %d failures, want 0", failed)
+	}
+	if elapsed := time.Since(start); elapsed > 800*time.Millisecond {
+		t.Errorf("took %v, want commands to run concurrently", elapsed)
+	}
+}
+
+func TestWarm_replaySignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are not supported on windows")
+	}
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	opt := option{ttl: time.Minute, cacheDir: tmpdir}
+	list := "-replay-signal sh -c 'kill -TERM $$'\necho ok\n"
+	entries, err := parseWarmList(strings.NewReader(list), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if failed := warm(out, entries, 2); failed != 1 {
+		t.Errorf("got %d failures, want 1: %s", failed, out)
+	}
+	if want := "killed by signal 15"; !strings.Contains(out.String(), want) {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
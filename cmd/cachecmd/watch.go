@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+func runWatch(args []string) (int, error) {
+	fs := newSubFlagSet("watch", "cachecmd watch [flags] {command}",
+		"cachecmd watch displays the (cached) result of the command repeatedly like watch(1).\n"+
+			"It runs the command only when cache is expired.")
+	interval := fs.Duration("n", 2*time.Second, "interval to display the result.")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2, nil
+	}
+	command := fs.Args()
+	if err := loadDefaultConfig(flagOpt); err != nil {
+		return 1, err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	header := fmt.Sprintf("Every %v: %s", *interval, strings.Join(command, " "))
+	err := watchLoop(ctx, os.Stdout, *interval, header, func(out io.Writer) error {
+		_, sig, err := runCommand(nil, out, out, *flagOpt, command)
+		if err == nil && sig != 0 {
+			fmt.Fprintf(out, "cachecmd: killed by signal %d\n", sig)
+		}
+		return err
+	})
+	return 0, err
+}
+
+// watchLoop clears screen and writes header and output of runOnce to out for
+// every interval until ctx is done.
+func watchLoop(ctx context.Context, out io.Writer, interval time.Duration,
+	header string, runOnce func(out io.Writer) error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		buf := new(bytes.Buffer)
+		if err := runOnce(buf); err != nil {
+			fmt.Fprintf(buf, "cachecmd: %v\n", err)
+		}
+		// Clear screen and move cursor to top left.
+		fmt.Fprint(out, "\x1b[H\x1b[2J")
+		fmt.Fprintf(out, "%s\t%s\n\n", header, time.Now().Format(time.RFC1123))
+		if _, err := io.Copy(out, buf); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// newSubFlagSet returns a flag set for subcommand which also has cachecmd
+// flags. Parsing cachecmd flags updates flagOpt.
+func newSubFlagSet(name, usage, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\t%s\n", usage)
+		fmt.Fprintf(os.Stderr, "\t%s\n", strings.Replace(description, "\n", "\n\t", -1))
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Flags:")
+		fs.PrintDefaults()
+	}
+	return fs
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchLoop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := new(bytes.Buffer)
+	n := 0
+	err := watchLoop(ctx, out, time.Millisecond, "Every 1ms: date", func(w io.Writer) error {
+		n++
+		io.WriteString(w, "result\n")
+		if n == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(out.String(), "Every 1ms: date"); got != 3 {
+		t.Errorf("got %d headers, want 3: %q", got, out.String())
+	}
+	if got := strings.Count(out.String(), "result\n"); got != 3 {
+		t.Errorf("got %d results, want 3: %q", got, out.String())
+	}
+}
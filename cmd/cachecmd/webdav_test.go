@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeWebDAV is a minimal WebDAV server which keeps files in memory.
+type fakeWebDAV struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	cols  map[string]bool
+}
+
+func (s *fakeWebDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user, pass, _ := r.BasicAuth(); user != "user" || pass != "pass" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		b, ok := s.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Write(b)
+	case http.MethodPut:
+		if !s.cols[path.Dir(r.URL.Path)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		s.files[r.URL.Path] = b
+		w.WriteHeader(http.StatusCreated)
+	case "MKCOL":
+		if s.cols[r.URL.Path] {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.cols[r.URL.Path] = true
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func TestCacheCmd_Run_webdavBackend(t *testing.T) {
+	dav := &fakeWebDAV{files: map[string][]byte{}, cols: map[string]bool{"/dav": true}}
+	ts := httptest.NewServer(dav)
+	defer ts.Close()
+	tmpdir, _ := ioutil.TempDir("", "cachecmdtest")
+	defer os.RemoveAll(tmpdir)
+	backend := "http://user:pass@" + ts.Listener.Addr().String() + "/dav/"
+	run := func(local string) (string, *CacheCmd) {
+		stdout := new(bytes.Buffer)
+		cachecmd := &CacheCmd{
+			stdout:  stdout,
+			stderr:  ioutil.Discard,
+			cmdName: "date",
+			cmdArgs: []string{"+%N"},
+			opt: option{ttl: time.Minute, cacheDir: filepath.Join(tmpdir, local),
+				namespace: "ns", backend: backend, backendSync: true},
+		}
+		if _, err := cachecmd.Run(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		return stdout.String(), cachecmd
+	}
+	first, c := run("local1")
+	if len(dav.files) != 1 {
+		t.Fatalf("got %d files in WebDAV, want 1", len(dav.files))
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if got, _ := run("local2"); got != first {
+		t.Errorf("got %q, want %q cached in WebDAV", got, first)
+	}
+	// The age is from metadata instead of Last-Modified of the server.
+	meta, err := readMeta(c.cacheFilePath() + ".ENTRY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pulled := filepath.Join(tmpdir, "local2", filepath.Base(c.cacheFilePath())+".ENTRY")
+	stat, err := os.Stat(pulled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(0, meta.CachedAt); !stat.ModTime().Equal(want) {
+		t.Errorf("got modification time %v, want %v", stat.ModTime(), want)
+	}
+}